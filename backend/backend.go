@@ -1,8 +1,14 @@
 package backend
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/dedelala/disco"
 	"github.com/dedelala/disco/faux"
@@ -19,6 +25,10 @@ type Config struct {
 	Hue  *hue.Config
 	Lifx *lifx.Config
 	Faux *faux.Config
+
+	// Timeout is the time each backend has to complete a command, by backend
+	// name.
+	Timeout map[string]string
 }
 
 func Load(file string) (*Config, error) {
@@ -31,16 +41,48 @@ func Load(file string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if c.Snapshots == "" {
+		c.Snapshots = filepath.Join(filepath.Dir(file), "disco.snapshots.json")
+	}
 	return &c, nil
 }
 
 var onShutdown []func()
 
 func New(cfg *Config) (disco.Cmdrs, error) {
-	var cmdrs disco.Cmdrs
+	var (
+		cmdrs disco.Cmdrs
+		add   = func(name string, c disco.Cmdr) error {
+			f, native := c.(disco.SwitchFader)
+			native = native && f.FadesSwitch()
+			if s, ok := cfg.Timeout[name]; ok {
+				d, err := time.ParseDuration(s)
+				if err != nil {
+					return fmt.Errorf("%s timeout: %w", name, err)
+				}
+				c = disco.WithTimeout(c, d)
+			}
+			if !native {
+				sf := disco.WithSwitchFade(c)
+				// let the fades finish before anything is closed
+				onShutdown = append([]func(){sf.Wait}, onShutdown...)
+				c = sf
+			}
+			cmdrs = append(cmdrs, disco.WithPrefix(c, name+"/"))
+			return nil
+		}
+	)
 	if cfg.Hue != nil {
-		h := huecmd.Cmdr{Client: hue.New(*cfg.Hue)}
-		cmdrs = append(cmdrs, disco.WithPrefix(h, "hue/"))
+		hc := huecmd.Cmdr{Client: hue.New(*cfg.Hue)}
+		var h disco.Cmdr = hc
+		if cfg.Hue.Area != "" {
+			s := huecmd.NewStreamer(hc, cfg.Hue.Area, cfg.Hue.Rate)
+			onShutdown = append(onShutdown, s.Close)
+			h = s
+		}
+		if err := add("hue", h); err != nil {
+			return nil, err
+		}
 	}
 	if cfg.Lifx != nil {
 		lc, err := lifx.New(*cfg.Lifx)
@@ -49,11 +91,15 @@ func New(cfg *Config) (disco.Cmdrs, error) {
 		}
 		onShutdown = append(onShutdown, lc.End)
 		l := lifxcmd.Cmdr{Client: lc}
-		cmdrs = append(cmdrs, disco.WithPrefix(l, "lifx/"))
+		if err := add("lifx", l); err != nil {
+			return nil, err
+		}
 	}
 	if cfg.Faux != nil {
 		x := fauxcmd.Cmdr{Client: faux.New(*cfg.Faux)}
-		cmdrs = append(cmdrs, disco.WithPrefix(x, "faux/"))
+		if err := add("faux", x); err != nil {
+			return nil, err
+		}
 	}
 
 	if len(cmdrs) == 0 {
@@ -63,6 +109,47 @@ func New(cfg *Config) (disco.Cmdrs, error) {
 	return cmdrs, nil
 }
 
+// Check validates the configuration. Map keys must be prefixed with a
+// configured backend and timeouts must be valid durations. If live is not nil
+// every mapped target must also exist on the live backends.
+func (c *Config) Check(ctx context.Context, live disco.Cmdr) error {
+	errs := []error{c.Config.Check()}
+	backends := map[string]bool{
+		"hue":  c.Hue != nil,
+		"lifx": c.Lifx != nil,
+		"faux": c.Faux != nil,
+	}
+	for k, s := range c.Timeout {
+		if !backends[k] {
+			errs = append(errs, fmt.Errorf("timeout %s: backend is not configured", k))
+		}
+		if _, err := time.ParseDuration(s); err != nil {
+			errs = append(errs, fmt.Errorf("timeout %s: %w", k, err))
+		}
+	}
+	keys := make([]string, 0, len(c.Map))
+	for k := range c.Map {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name, _, _ := strings.Cut(k, "/")
+		if !backends[name] {
+			errs = append(errs, fmt.Errorf("map %s: backend %s is not configured", c.Map[k], name))
+		}
+	}
+	if live == nil {
+		return errors.Join(errs...)
+	}
+
+	cmds, err := live.Cmd(ctx, []disco.Cmd{{Action: "switch"}})
+	targets := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		targets = append(targets, cmd.Target)
+	}
+	return errors.Join(append(errs, err, c.CheckTargets(targets))...)
+}
+
 func Shutdown() {
 	for _, f := range onShutdown {
 		f()
@@ -0,0 +1,16 @@
+package backend
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckExample(t *testing.T) {
+	c, err := Load("../disco.example.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Check(context.Background(), nil); err != nil {
+		t.Error(err)
+	}
+}
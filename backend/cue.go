@@ -0,0 +1,136 @@
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/dedelala/disco"
+	"gopkg.in/yaml.v3"
+)
+
+// AddCue writes cue into the Cue section of the config file, replacing any
+// cue with the same slug. The rest of the file is left as it is, comments and
+// all.
+func AddCue(file, slug string, cue disco.Cue) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	b, err = addCue(b, slug, cue)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return os.WriteFile(file, b, 0644)
+}
+
+func addCue(b []byte, slug string, cue disco.Cue) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	lines = lines[:len(lines)-1]
+
+	if len(doc.Content) == 0 {
+		return nil, errors.New("config is empty")
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("config is not a mapping")
+	}
+	i := keyIndex(root.Content, "Cue")
+	if i < 0 {
+		entry, err := cueLines(slug, cue, "  ")
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, "\nCue:\n")
+		return []byte(strings.Join(append(lines, entry...), "")), nil
+	}
+	cues := root.Content[i+1]
+	if cues.Kind != yaml.MappingNode {
+		return nil, errors.New("Cue is not a mapping")
+	}
+
+	// end of the Cue section, before the next section and its comments
+	end := len(lines)
+	if i+2 < len(root.Content) {
+		end = root.Content[i+2].Line - 1
+	}
+	indent := "  "
+	if len(cues.Content) > 0 {
+		indent = strings.Repeat(" ", cues.Content[0].Column-1)
+	}
+	entry, err := cueLines(slug, cue, indent)
+	if err != nil {
+		return nil, err
+	}
+
+	// replace the lines from at to to, or insert after the last cue
+	at := backOver(lines, end, len(indent))
+	to := at
+	if j := keyIndex(cues.Content, slug); j >= 0 {
+		at = cues.Content[j].Line - 1
+		if j+2 < len(cues.Content) {
+			to = backOver(lines, cues.Content[j+2].Line-1, len(indent))
+		}
+	}
+	out := append(append(slices.Clone(lines[:at]), entry...), lines[to:]...)
+	return []byte(strings.Join(out, "")), nil
+}
+
+// keyIndex returns the index of key in the content of a mapping node.
+func keyIndex(content []*yaml.Node, key string) int {
+	for i := 0; i+1 < len(content); i += 2 {
+		if content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// backOver moves end back over blank lines and comments indented at most
+// indent, which belong to whatever follows.
+func backOver(lines []string, end, indent int) int {
+	for end > 0 {
+		l := lines[end-1]
+		t := strings.TrimLeft(l, " ")
+		if strings.TrimSpace(l) != "" && !(strings.HasPrefix(t, "#") && len(l)-len(t) <= indent) {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+func cueLines(slug string, cue disco.Cue, indent string) ([]string, error) {
+	cmds := make([]string, len(cue.Cmds))
+	for i, cmd := range cue.Cmds {
+		cmds[i] = cmd.String()
+	}
+	var (
+		bb  bytes.Buffer
+		enc = yaml.NewEncoder(&bb)
+	)
+	enc.SetIndent(2)
+	err := enc.Encode(map[string]any{slug: struct {
+		Text string   `yaml:"Text"`
+		Cmds []string `yaml:"Cmds"`
+	}{cue.Text, cmds}})
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitAfter(bb.String(), "\n")
+	lines = lines[:len(lines)-1]
+	for i := range lines {
+		lines[i] = indent + lines[i]
+	}
+	return lines, nil
+}
@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dedelala/disco"
+	"github.com/ghodss/yaml"
+)
+
+func TestAddCue(t *testing.T) {
+	const in = `# top
+Link:
+  ab: [a, b]
+
+# cues
+Cue:
+  one:
+    Text: One
+    Cmds:
+      - switch a on
+      # - switch b on
+  # two is the second
+  two:
+    Text: Two
+    Cmds:
+      - switch b on
+
+# chases
+Chase:
+  c:
+    Text: C
+`
+	cue := disco.Cue{Text: "Scene: 1", Cmds: []disco.Cmd{disco.ParseCmdString("dim ab 50")}}
+	var zs = []struct {
+		slug string
+		ex   string
+	}{
+		{"one", strings.Replace(in, `  one:
+    Text: One
+    Cmds:
+      - switch a on
+      # - switch b on
+`, `  one:
+    Text: 'Scene: 1'
+    Cmds:
+      - dim ab 50
+`, 1)},
+		{"two", strings.Replace(in, `  two:
+    Text: Two
+    Cmds:
+      - switch b on
+`, `  two:
+    Text: 'Scene: 1'
+    Cmds:
+      - dim ab 50
+`, 1)},
+		{"three", strings.Replace(in, `      - switch b on
+`, `      - switch b on
+  three:
+    Text: 'Scene: 1'
+    Cmds:
+      - dim ab 50
+`, 1)},
+	}
+	for _, z := range zs {
+		b, err := addCue([]byte(in), z.slug, cue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != z.ex {
+			t.Errorf("%s: expected\n%s\ngot\n%s", z.slug, z.ex, b)
+		}
+		var c Config
+		if err := yaml.Unmarshal(b, &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Cue[z.slug].Text != cue.Text || c.Cue[z.slug].Cmds[0].String() != "dim ab 50" {
+			t.Errorf("%s: unexpected cue %v", z.slug, c.Cue[z.slug])
+		}
+	}
+}
+
+func TestAddCueExample(t *testing.T) {
+	b, err := os.ReadFile("../disco.example.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := addCue(b, "light-on", disco.Cue{Text: "Light On", Cmds: []disco.Cmd{disco.ParseCmdString("switch all on")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(b) {
+		t.Error("expected replacing a cue with itself to change nothing")
+	}
+}
@@ -17,6 +17,8 @@ fi
 [[ -n $REMOTE ]] || die "please set REMOTE ssh host"
 [[ -f disco.yml ]] || die "no disco.yml found at repository root"
 
+go run ./cmd/disco -c disco.yml check || die "check"
+
 rm -rf dist
 mkdir -p dist
 
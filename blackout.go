@@ -0,0 +1,269 @@
+package disco
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrBlackout is returned for chase steps during a blackout, so the chase
+// waits on the step rather than fight it.
+var ErrBlackout = errors.New("blackout")
+
+// Blackout switches everything off, over a duration if given, remembering the
+// state it was in, and puts it back when the blackout is off.
+//
+//	blackout [duration]
+//	blackout off [duration]
+//
+// During a blackout, commands change the state to put back instead of the
+// lights, getters answer from it, and chase steps fail with ErrBlackout.
+type Blackout struct {
+	Cmdr
+
+	mu *sync.Mutex
+	st *blackoutState
+}
+
+type blackoutState struct {
+	on   bool
+	held map[[2]string]Cmd
+	// changed is the state set during the blackout
+	changed map[[2]string]bool
+}
+
+func WithBlackout(c Cmdr) Blackout {
+	return Blackout{
+		Cmdr: c,
+		mu:   &sync.Mutex{},
+		st:   &blackoutState{},
+	}
+}
+
+// checkBlackout validates the args of blackout or blackout off.
+func checkBlackout(args []string) error {
+	if len(args) > 0 {
+		if _, err := time.ParseDuration(args[0]); err != nil {
+			return err
+		}
+	}
+	return checkArgc(args, 1)
+}
+
+type chaseKey struct{}
+
+// inChase reports whether ctx is for a chase step.
+func inChase(ctx context.Context) bool {
+	v, _ := ctx.Value(chaseKey{}).(bool)
+	return v
+}
+
+func (b Blackout) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var (
+		cout    []Cmd
+		errs    error
+		pending []Cmd
+	)
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		cs, err := b.apply(ctx, pending)
+		cout = append(cout, cs...)
+		errs = errors.Join(errs, err)
+		pending = nil
+	}
+	for _, cmd := range cmds {
+		if cmd.Action != "blackout" {
+			pending = append(pending, cmd)
+			continue
+		}
+		flush()
+		var (
+			cs  []Cmd
+			err error
+		)
+		if cmd.Target == "off" {
+			cs, err = b.restore(ctx, cmd.Args)
+		} else {
+			cs, err = b.blackout(ctx, cmd)
+		}
+		cout = append(cout, cs...)
+		errs = errors.Join(errs, err)
+	}
+	flush()
+	return cout, errs
+}
+
+// apply holds the state set by cmds during a blackout, and passes the rest on.
+func (b Blackout) apply(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	b.mu.Lock()
+	if !b.st.on {
+		b.mu.Unlock()
+		return b.Cmdr.Cmd(ctx, cmds)
+	}
+	if inChase(ctx) {
+		b.mu.Unlock()
+		return nil, ErrBlackout
+	}
+
+	var cout, pass []Cmd
+	for _, cmd := range cmds {
+		if !slices.Contains(cached, cmd.Action) || cmd.Target == "" && len(cmd.Args) > 0 {
+			pass = append(pass, cmd)
+			continue
+		}
+		if len(cmd.Args) == 0 {
+			cs := b.held(func(k [2]string) bool {
+				return k[0] == cmd.Action && (cmd.Target == "" || k[1] == cmd.Target)
+			})
+			if len(cs) == 0 && cmd.Target != "" {
+				pass = append(pass, cmd)
+			}
+			cout = append(cout, cs...)
+			continue
+		}
+		set, ok := stateOf(cmd)
+		if cmd.Action == "gradient" {
+			set, ok = cmd, true
+		}
+		if !ok {
+			pass = append(pass, cmd)
+			continue
+		}
+		trace(ctx, Step{Stage: "blackout", In: cmd, Note: "held for after the blackout"})
+		record(ctx, Result{Cmd: cmd, Status: Held, Err: ErrBlackout})
+		if !IsDryRun(ctx) {
+			k := [2]string{set.Action, set.Target}
+			b.st.held[k] = set
+			b.st.changed[k] = true
+		}
+	}
+	b.mu.Unlock()
+
+	if len(pass) == 0 {
+		return cout, nil
+	}
+	cs, err := b.Cmdr.Cmd(ctx, pass)
+	return append(cout, cs...), err
+}
+
+// held returns the held state for the keys that match, in order of target.
+// The caller holds the lock.
+func (b Blackout) held(match func([2]string) bool) []Cmd {
+	var cmds []Cmd
+	for k, cmd := range b.st.held {
+		if match(k) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	slices.SortFunc(cmds, func(x, y Cmd) int {
+		return cmp.Or(cmp.Compare(x.Target, y.Target), cmp.Compare(x.Action, y.Action))
+	})
+	return cmds
+}
+
+// blackout remembers the state of everything and switches off what is on.
+func (b Blackout) blackout(ctx context.Context, cmd Cmd) ([]Cmd, error) {
+	var args []string
+	if cmd.Target != "" {
+		args = append([]string{cmd.Target}, cmd.Args...)
+	}
+	if err := checkBlackout(args); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	on := b.st.on
+	b.mu.Unlock()
+	if on {
+		return nil, nil
+	}
+
+	gets := make([]Cmd, len(cached))
+	for i, action := range cached {
+		gets[i] = Cmd{Action: action}
+	}
+	cs, err := b.Cmdr.Cmd(quiet(ctx), gets)
+	if len(cs) == 0 && err != nil {
+		return nil, err
+	}
+	held := map[[2]string]Cmd{}
+	var offs []Cmd
+	for _, c := range cs {
+		if len(c.Args) == 0 {
+			continue
+		}
+		held[[2]string{c.Action, c.Target}] = c
+		if c.Action == "switch" && c.Args[0] == "on" {
+			offs = append(offs, Cmd{Action: "switch", Target: c.Target, Args: append([]string{"off"}, args...)})
+		}
+	}
+	slices.SortFunc(offs, func(x, y Cmd) int { return cmp.Compare(x.Target, y.Target) })
+	trace(ctx, Step{Stage: "blackout", In: cmd, Out: slices.Clone(offs), Note: "switch off what is on"})
+
+	if !IsDryRun(ctx) {
+		b.mu.Lock()
+		b.st.on = true
+		b.st.held = held
+		b.st.changed = map[[2]string]bool{}
+		b.mu.Unlock()
+	}
+	if len(offs) == 0 {
+		return nil, err
+	}
+	cout, serr := b.Cmdr.Cmd(ctx, offs)
+	return cout, errors.Join(err, serr)
+}
+
+// restore ends the blackout, setting the state changed during it while the
+// lights are off, then switching on what was on.
+func (b Blackout) restore(ctx context.Context, args []string) ([]Cmd, error) {
+	if err := checkBlackout(args); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	if !b.st.on {
+		b.mu.Unlock()
+		return nil, nil
+	}
+	sets := b.held(func(k [2]string) bool {
+		return k[0] != "switch" && b.st.changed[k]
+	})
+	ons := b.held(func(k [2]string) bool {
+		return k[0] == "switch" && b.st.held[k].Args[0] == "on"
+	})
+	if !IsDryRun(ctx) {
+		b.st.on = false
+		b.st.held, b.st.changed = nil, nil
+	}
+	b.mu.Unlock()
+
+	for i, c := range sets {
+		if c.Action != "gradient" {
+			sets[i].Args = []string{c.Args[0], "0s"}
+		}
+	}
+	for i := range ons {
+		ons[i].Args = append(ons[i].Args[:1:1], args...)
+	}
+	trace(ctx, Step{Stage: "blackout", In: Cmd{Action: "blackout", Target: "off", Args: args}, Out: slices.Concat(sets, ons), Note: "put back what was held"})
+
+	var (
+		cout []Cmd
+		errs error
+	)
+	for _, cmds := range [][]Cmd{sets, ons} {
+		if len(cmds) == 0 {
+			continue
+		}
+		cs, err := b.Cmdr.Cmd(ctx, cmds)
+		cout = append(cout, cs...)
+		errs = errors.Join(errs, err)
+	}
+	return cout, errs
+}
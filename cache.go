@@ -0,0 +1,264 @@
+package disco
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedelala/disco/color"
+)
+
+// Cache answers getters from a model of every target, kept up to date by the
+// Cmdr's Watch stream and by the commands passed through it. The model is
+// refreshed in full with the getters if it is older than MaxAge, or when the
+// watch stream drops, in which case the stream is started again. A
+// MultiWatcher drops the Cache's subscription rather than a change, so no
+// change is missed. Close stops the watch.
+type Cache struct {
+	Cmdr
+	MaxAge time.Duration
+
+	mu *sync.Mutex
+	st *cacheState
+}
+
+type cacheState struct {
+	model    map[[2]string]Cmd
+	at       time.Time
+	watching bool
+	refresh  *sync.Mutex
+	ctx      context.Context
+	cancel   func()
+}
+
+// cached is the actions the cache keeps.
+var cached = []string{"switch", "dim", "color", "gradient"}
+
+func WithCache(c Cmdr, maxAge time.Duration) Cache {
+	ctx, cancel := context.WithCancel(context.Background())
+	return Cache{
+		Cmdr:   c,
+		MaxAge: maxAge,
+		mu:     &sync.Mutex{},
+		st: &cacheState{
+			model:   map[[2]string]Cmd{},
+			refresh: &sync.Mutex{},
+			ctx:     ctx,
+			cancel:  cancel,
+		},
+	}
+}
+
+// Close stops the watch stream.
+func (c Cache) Close() {
+	c.st.cancel()
+}
+
+func (c Cache) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var gets, sets []Cmd
+	for _, cmd := range cmds {
+		if len(cmd.Args) == 0 && slices.Contains(cached, cmd.Action) {
+			gets = append(gets, cmd)
+		} else {
+			sets = append(sets, cmd)
+		}
+	}
+
+	var (
+		cout []Cmd
+		errs error
+	)
+	if len(gets) > 0 {
+		cs, err := c.get(ctx, gets)
+		cout = append(cout, cs...)
+		errs = errors.Join(errs, err)
+	}
+	if len(sets) > 0 {
+		cs, err := c.Cmdr.Cmd(ctx, sets)
+		cout = append(cout, cs...)
+		errs = errors.Join(errs, err)
+		if !IsDryRun(ctx) {
+			c.update(sets, err)
+		}
+	}
+	return cout, errs
+}
+
+func (c Cache) get(ctx context.Context, gets []Cmd) ([]Cmd, error) {
+	err := c.fresh(ctx)
+
+	var (
+		cout   []Cmd
+		misses []Cmd
+	)
+	c.mu.Lock()
+	for _, get := range gets {
+		if get.Target == "" {
+			for k, cmd := range c.st.model {
+				if k[0] == get.Action {
+					cout = append(cout, cmd)
+				}
+			}
+			continue
+		}
+		cmd, ok := c.st.model[[2]string{get.Action, get.Target}]
+		if !ok {
+			misses = append(misses, get)
+			continue
+		}
+		cout = append(cout, cmd)
+	}
+	c.mu.Unlock()
+
+	if len(misses) > 0 {
+		cs, merr := c.Cmdr.Cmd(ctx, misses)
+		cout = append(cout, cs...)
+		err = errors.Join(err, merr)
+		c.mu.Lock()
+		for _, cmd := range cs {
+			c.st.model[[2]string{cmd.Action, cmd.Target}] = cmd
+		}
+		c.mu.Unlock()
+	}
+	return cout, err
+}
+
+// fresh refreshes the model if it is stale and starts the watch stream if it
+// is not running.
+func (c Cache) fresh(ctx context.Context) error {
+	c.st.refresh.Lock()
+	defer c.st.refresh.Unlock()
+
+	c.mu.Lock()
+	ok := c.st.watching && time.Since(c.st.at) < c.MaxAge
+	watching := c.st.watching
+	c.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	var errs error
+	if !watching {
+		errs = c.watch()
+	}
+
+	gets := make([]Cmd, len(cached))
+	for i, action := range cached {
+		gets[i] = Cmd{Action: action}
+	}
+	cs, err := c.Cmdr.Cmd(quiet(ctx), gets)
+	if len(cs) == 0 && err != nil {
+		return errors.Join(errs, err)
+	}
+	model := map[[2]string]Cmd{}
+	for _, cmd := range cs {
+		model[[2]string{cmd.Action, cmd.Target}] = cmd
+	}
+	c.mu.Lock()
+	c.st.model = model
+	c.st.at = time.Now()
+	c.mu.Unlock()
+	return errors.Join(errs, err)
+}
+
+func (c Cache) watch() error {
+	ctx := c.st.ctx
+	cmds, err := c.Cmdr.Watch(WithPolicy(ctx, Disconnect))
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.st.watching = true
+	c.mu.Unlock()
+
+	go func() {
+		for cmd := range cmds {
+			if !slices.Contains(cached, cmd.Action) || len(cmd.Args) == 0 {
+				continue
+			}
+			c.mu.Lock()
+			c.st.model[[2]string{cmd.Action, cmd.Target}] = cmd
+			c.mu.Unlock()
+		}
+		c.mu.Lock()
+		c.st.watching = false
+		c.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("cache watch dropped")
+		// changes may have been missed, read everything again
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+		if err := c.fresh(ctx); err != nil {
+			slog.Warn("cache refresh", "error", err)
+		}
+	}()
+	return nil
+}
+
+// update sets the model to the state set by cmds, except for the targets
+// that failed. Gradients, and switches over a duration, which may go off
+// after the call returns, are left to the watch stream.
+func (c Cache) update(cmds []Cmd, err error) {
+	failed := failedTargets(err)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cmd := range cmds {
+		set, ok := stateOf(cmd)
+		if !ok || failed(cmd.Target) || cmd.Action == "switch" && len(cmd.Args) > 1 {
+			continue
+		}
+		c.st.model[[2]string{set.Action, set.Target}] = set
+	}
+}
+
+// failedTargets returns a func that reports whether err says target failed,
+// by itself or along with the rest of its backend.
+func failedTargets(err error) func(target string) bool {
+	es := AsErrors(err)
+	return func(target string) bool {
+		return slices.ContainsFunc(es, func(e *Error) bool {
+			if e.Target == "" {
+				return e.Backend == "" || strings.HasPrefix(target, e.Backend+"/")
+			}
+			return e.Target == target
+		})
+	}
+}
+
+// stateOf returns the switch, dim or color that cmd sets, as a getter would
+// report it.
+func stateOf(cmd Cmd) (Cmd, bool) {
+	if cmd.Target == "" || len(cmd.Args) == 0 {
+		return Cmd{}, false
+	}
+	switch cmd.Action {
+	case "switch":
+		on, err := ParseSwitch(cmd.Args[0])
+		if err != nil {
+			return Cmd{}, false
+		}
+		return SwitchCmd(cmd.Target, on), true
+	case "dim":
+		v, err := ParseDim(cmd.Args[0])
+		if err != nil {
+			return Cmd{}, false
+		}
+		return DimCmd(cmd.Target, v), true
+	case "color":
+		clr, err := color.Parse(cmd.Args[0])
+		if err != nil {
+			return Cmd{}, false
+		}
+		return ColorCmd(cmd.Target, clr), true
+	}
+	return Cmd{}, false
+}
@@ -0,0 +1,299 @@
+package disco
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dedelala/disco/color"
+)
+
+// Check validates the configuration and returns every problem found. Commands
+// in cues and chases must be well formed, cues and chases on the sheet must
+// exist, and links must resolve to known targets without cycles.
+func (c Config) Check() error {
+	var (
+		errs  []error
+		names = map[string]bool{}
+		l     = WithLink(nil, c.Link)
+	)
+	for _, name := range c.Map {
+		names[name] = true
+	}
+	known := func(target string) bool {
+		_, link := c.Link[target]
+		return link || names[target] || strings.Contains(target, "/")
+	}
+
+	for _, k := range sortedKeys(c.Link) {
+		if _, ok := c.Map[k]; ok || names[k] {
+			errs = append(errs, fmt.Errorf("link %s: shadows a mapped name", k))
+		}
+		for _, target := range c.Link[k] {
+			if !known(target) {
+				errs = append(errs, fmt.Errorf("link %s: %s is not a link or mapped name", k, target))
+			}
+		}
+		if _, err := l.Expand(k); err != nil {
+			errs = append(errs, fmt.Errorf("link %s: %w", k, err))
+		}
+	}
+
+	if err := CheckToggleRule(c.Toggle); err != nil {
+		errs = append(errs, fmt.Errorf("toggle: %w", err))
+	}
+
+	for _, k := range sortedKeys(c.Map) {
+		if !strings.Contains(k, "/") {
+			errs = append(errs, fmt.Errorf("map %s: is not a prefixed device id", k))
+		}
+	}
+
+	q := WithCue(nil, c.Cue)
+	for _, k := range sortedKeys(c.Cue) {
+		for _, cmd := range c.Cue[k].Cmds {
+			if err := c.checkCmd(cmd, known); err != nil {
+				errs = append(errs, fmt.Errorf("cue %s: %s: %w", k, cmd, err))
+			}
+		}
+		if _, err := q.expand(Cmd{Action: "cue", Target: k}, nil); err != nil {
+			errs = append(errs, fmt.Errorf("cue %s: %w", k, err))
+		}
+	}
+
+	for _, k := range sortedKeys(c.Chase) {
+		if len(c.Chase[k].Steps) == 0 {
+			errs = append(errs, fmt.Errorf("chase %s: has no steps", k))
+		}
+		for i, step := range c.Chase[k].Steps {
+			var wait bool
+			for _, cmd := range step {
+				if cmd.Action == "wait" {
+					wait = true
+					if _, err := time.ParseDuration(cmd.Target); err != nil {
+						errs = append(errs, fmt.Errorf("chase %s step %d: %s: %w", k, i, cmd, err))
+					}
+					continue
+				}
+				if err := c.checkCmd(cmd, known); err != nil {
+					errs = append(errs, fmt.Errorf("chase %s step %d: %s: %w", k, i, cmd, err))
+				}
+			}
+			if !wait {
+				errs = append(errs, fmt.Errorf("chase %s step %d: has no wait", k, i))
+			}
+		}
+	}
+
+	for _, p := range c.Sheet {
+		for _, s := range p.Sections {
+			at := strings.TrimSpace("sheet " + p.Text + " " + s.Text)
+			for _, g := range s.Group {
+				for _, call := range g {
+					if _, ok := c.Cue[call.Cue]; call.Cue != "" && !ok {
+						errs = append(errs, fmt.Errorf("%s: cue %s not found", at, call.Cue))
+					}
+					if _, ok := c.Chase[call.Chase]; call.Chase != "" && !ok {
+						errs = append(errs, fmt.Errorf("%s: chase %s not found", at, call.Chase))
+					}
+					if call.Record != "" && len(call.Targets) == 0 {
+						errs = append(errs, fmt.Errorf("%s: record %s has no targets", at, call.Record))
+					}
+					for _, target := range call.Targets {
+						if !known(target) {
+							errs = append(errs, fmt.Errorf("%s: record %s: %s is not a link or mapped name", at, call.Record, target))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c Config) checkCmd(cmd Cmd, known func(string) bool) error {
+	switch cmd.Action {
+	case "cue":
+		return nil // checked by expanding the cue
+	case "snapshot":
+		if len(cmd.Args) > 0 && !known(cmd.Args[0]) {
+			return fmt.Errorf("%s is not a link or mapped name", cmd.Args[0])
+		}
+		return checkArgc(cmd.Args, 1)
+	case "undo", "redo":
+		return nil
+	case "master", "blackout":
+		return CheckCmd(cmd)
+	case "sub":
+		if _, ok := c.Link[cmd.Target]; !ok {
+			return fmt.Errorf("%s is not a link", cmd.Target)
+		}
+		return CheckCmd(cmd)
+	case "restore":
+		if len(cmd.Args) > 0 {
+			if _, err := time.ParseDuration(cmd.Args[0]); err != nil {
+				return err
+			}
+		}
+		return checkArgc(cmd.Args, 1)
+	}
+	if cmd.Target == "" {
+		return errors.New("has no target")
+	}
+	if !known(cmd.Target) {
+		return fmt.Errorf("%s is not a link or mapped name", cmd.Target)
+	}
+	return CheckCmd(cmd)
+}
+
+// CheckCmd validates the args of a command that sets state.
+func CheckCmd(cmd Cmd) error {
+	var (
+		args = cmd.Args
+		n    int
+	)
+	switch cmd.Action {
+	case "switch":
+		n = 2
+		if len(args) > 0 {
+			if _, err := ParseSwitch(args[0]); err != nil {
+				return err
+			}
+		}
+	case "dim":
+		n = 2
+		if IsRelative(cmd) {
+			if _, err := ParseRelDim(args[0]); err != nil {
+				return err
+			}
+		} else if len(args) > 0 {
+			if _, err := ParseDim(args[0]); err != nil {
+				return err
+			}
+		}
+	case "color":
+		n = 2
+		if IsRelative(cmd) {
+			_, rest, err := ParseRelColor(args)
+			if err != nil {
+				return err
+			}
+			if len(rest) > 0 {
+				if _, err := time.ParseDuration(rest[0]); err != nil {
+					return err
+				}
+			}
+			return checkArgc(args, len(args)-len(rest)+1)
+		}
+		if len(args) > 0 {
+			if _, err := color.Parse(args[0]); err != nil {
+				return fmt.Errorf("%s is not a color", args[0])
+			}
+		}
+	case "splay", "shuffle":
+		n = 3
+		if len(args) < 2 {
+			return errors.New("needs two colors")
+		}
+		for _, arg := range args[:2] {
+			if _, err := color.Parse(arg); err != nil {
+				return fmt.Errorf("%s is not a color", arg)
+			}
+		}
+		if len(args) > 2 {
+			if _, err := time.ParseDuration(args[2]); err != nil {
+				return err
+			}
+		}
+		return checkArgc(args, n)
+	case "master", "sub":
+		n = 2
+		if cmd.Action == "master" && cmd.Target != "" {
+			args = append([]string{cmd.Target}, args...)
+		}
+		if len(args) > 0 {
+			if _, err := ParseDim(args[0]); err != nil {
+				return err
+			}
+		}
+	case "park":
+		_, err := parkCmds(cmd)
+		return err
+	case "unpark":
+		return checkArgc(args, 0)
+	case "blackout":
+		if cmd.Target != "off" && cmd.Target != "" {
+			args = append([]string{cmd.Target}, args...)
+		}
+		return checkBlackout(args)
+	case "toggle":
+		if len(args) > 0 {
+			if err := CheckToggleRule(args[0]); err != nil {
+				return err
+			}
+		}
+		return checkArgc(args, 1)
+	case "gradient":
+		for i, arg := range args {
+			if _, err := color.Parse(arg); err == nil {
+				continue
+			}
+			if _, err := time.ParseDuration(arg); err == nil && i == len(args)-1 {
+				continue
+			}
+			if i == 0 {
+				continue // mode, checked by the backend
+			}
+			return fmt.Errorf("%s is not a color", arg)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown action %s", cmd.Action)
+	}
+	if len(args) == 0 {
+		return errors.New("has no value")
+	}
+	if len(args) > 1 {
+		if _, err := ParseDuration(args); err != nil {
+			return err
+		}
+	}
+	return checkArgc(args, n)
+}
+
+func checkArgc(args []string, n int) error {
+	if len(args) > n {
+		return fmt.Errorf("too many args %s", strings.Join(args[n:], " "))
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+// CheckTargets reports mapped targets that are not found among the targets of
+// the live backends. Sub targets such as gradient points are found if their
+// device is.
+func (c Config) CheckTargets(live []string) error {
+	var errs []error
+	for _, k := range sortedKeys(c.Map) {
+		device := k
+		if i := strings.LastIndex(k, "/"); strings.Count(k, "/") > 1 {
+			device = k[:i]
+		}
+		if !slices.Contains(live, k) && !slices.Contains(live, device) {
+			errs = append(errs, fmt.Errorf("map %s: %s not found", c.Map[k], k))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -8,8 +8,11 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
 	"sort"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/dedelala/disco"
 	"github.com/dedelala/disco/backend"
@@ -31,9 +34,41 @@ func colorStdout(cmd disco.Cmd) string {
 type flags struct {
 	config   string
 	watch    bool
+	initial  bool
+	results  bool
+	explain  bool
+	dryRun   bool
+	timeout  time.Duration
 	logLevel slog.Level
 }
 
+// explain prints each step of the trace in pipeline order.
+func explain(steps []disco.Step) {
+	stages := []string{"cue", "toggle", "splay", "link", "relative", "park", "master", "blackout", "map", "backend", "fade"}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return slices.Index(stages, steps[i].Stage) < slices.Index(stages, steps[j].Stage)
+	})
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, s := range steps {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Stage, s.In, s.Note)
+		for _, cmd := range s.Out {
+			fmt.Fprintf(w, "\t  %s\t\n", cmd)
+		}
+	}
+	w.Flush()
+}
+
+// report prints each problem in err and returns the exit code.
+func report(err error) int {
+	if err == nil {
+		return 0
+	}
+	for _, line := range strings.Split(err.Error(), "\n") {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	return 1
+}
+
 func main() {
 	var f flags
 
@@ -44,6 +79,11 @@ func main() {
 
 	flag.StringVar(&f.config, "c", configDir+"disco.yml", "path to config `file`")
 	flag.BoolVar(&f.watch, "w", false, "watch for changes")
+	flag.BoolVar(&f.initial, "i", false, "when watching, print the state of everything first")
+	flag.BoolVar(&f.results, "r", false, "report the result for each target")
+	flag.BoolVar(&f.dryRun, "n", false, "dry run, print the requests that would be made")
+	flag.BoolVar(&f.explain, "explain", false, "print the expansion of the command at each stage")
+	flag.DurationVar(&f.timeout, "t", 10*time.Second, "command `timeout`")
 	flag.TextVar(&f.logLevel, "v", f.logLevel, "log `level`")
 	flag.Parse()
 
@@ -54,6 +94,12 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	check := flag.Arg(0) == "check"
+	if check && flag.Arg(1) != "live" {
+		os.Exit(report(cfg.Check(context.Background(), nil)))
+	}
+
 	cmdrs, err := backend.New(cfg)
 	if err != nil {
 		log.Fatal(err)
@@ -62,10 +108,23 @@ func main() {
 
 	cmdr := disco.New(cmdrs, cfg.Config)
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if check {
+		ctx, cancel := context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+		os.Exit(report(cfg.Check(ctx, cmdrs)))
+	}
+
 	if f.watch {
-		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-		defer stop()
-		c, err := cmdr.Watch(ctx)
+		watch := cmdr.Watch
+		if f.initial {
+			watch = func(ctx context.Context) (<-chan disco.Cmd, error) {
+				return disco.Replay(ctx, cmdr)
+			}
+		}
+		c, err := watch(ctx)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -75,10 +134,46 @@ func main() {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	if flag.Arg(0) == "record-cue" {
+		if flag.NArg() < 4 {
+			log.Fatal("usage: disco record-cue <slug> <text> <targets...>")
+		}
+		cue := disco.Cue{Text: flag.Arg(2)}
+		cue.Cmds, err = disco.Record(ctx, cmdr, disco.WithLink(nil, cfg.Link), flag.Args()[3:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := backend.AddCue(f.config, flag.Arg(1), cue); err != nil {
+			log.Fatal(err)
+		}
+		for _, cmd := range cue.Cmds {
+			fmt.Printf("%s\n", cmd)
+		}
+		return
+	}
+
+	ctx, rs := disco.WithResults(ctx)
+	ctx, tr := disco.WithTrace(ctx)
+	if f.dryRun {
+		ctx = disco.WithDryRun(ctx)
+	}
 	cmd := disco.ParseCmd(flag.Args())
-	cmds, err := cmdr.Cmd([]disco.Cmd{cmd})
-	if err != nil {
-		slog.Error(err.Error())
+	cmds, err := cmdr.Cmd(ctx, []disco.Cmd{cmd})
+	if f.explain {
+		explain(tr.List())
+	}
+	for _, e := range disco.AsErrors(err) {
+		slog.Error(e.Err.Error(), "backend", e.Backend, "target", e.Target)
+	}
+	if f.results {
+		w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+		for _, r := range rs.List() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Status, r.Cmd.Tabbed(), r.Device)
+		}
+		w.Flush()
 	}
 	sort.Slice(cmds, func(i, j int) bool {
 		return cmds[i].String() < cmds[j].String()
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"flag"
 	"fmt"
@@ -12,8 +13,11 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/dedelala/disco"
 	"github.com/dedelala/disco/backend"
@@ -21,11 +25,14 @@ import (
 
 type page struct {
 	config disco.Config
+	cuer   disco.Cuer
 	chaser disco.Chaser
+	reach  reach
 }
 
 func (p page) Cue(s string) string {
-	return p.config.Cue[s].Text
+	cue, _ := p.cuer.Cue(s)
+	return cue.Text
 }
 
 func (p page) Chase(s string) string {
@@ -36,6 +43,22 @@ func (p page) Chasing() []string {
 	return p.chaser.Chasing()
 }
 
+func (p page) Unreachable() []string {
+	return p.reach.Unreachable()
+}
+
+func (p page) Parked() []string {
+	cmds, err := p.cuer.Cmd(context.Background(), []disco.Cmd{{Action: "park"}})
+	if err != nil {
+		slog.Warn("park", "error", err)
+	}
+	var ss []string
+	for _, cmd := range cmds {
+		ss = append(ss, strings.TrimPrefix(cmd.String(), "park "))
+	}
+	return ss
+}
+
 func (p page) Sheet() []disco.Page {
 	return p.config.Sheet
 }
@@ -92,8 +115,63 @@ func (h pageHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	io.Copy(w, &bb)
 }
 
+// reach keeps track of the lights that are not reachable.
+type reach struct {
+	mu   *sync.Mutex
+	down map[string]bool
+}
+
+func newReach() reach {
+	return reach{mu: &sync.Mutex{}, down: map[string]bool{}}
+}
+
+func (r reach) Unreachable() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ts []string
+	for t := range r.down {
+		ts = append(ts, t)
+	}
+	sort.Strings(ts)
+	return ts
+}
+
+func (r reach) set(cmd disco.Cmd) {
+	if cmd.Action != "status" || len(cmd.Args) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cmd.Args[0] == "reachable" {
+		delete(r.down, cmd.Target)
+	} else {
+		r.down[cmd.Target] = true
+	}
+}
+
+// watch reads the status of every light and follows the changes until the
+// watch stream ends.
+func (r reach) watch(ctx context.Context, c disco.Cmdr) error {
+	cmds, err := c.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	cs, err := c.Cmd(ctx, []disco.Cmd{{Action: "status"}})
+	if err != nil {
+		slog.Warn("status", "error", err)
+	}
+	for _, cmd := range cs {
+		r.set(cmd)
+	}
+	for cmd := range cmds {
+		r.set(cmd)
+	}
+	return ctx.Err()
+}
+
 type cueHandler struct {
 	disco.Cmdr
+	timeout time.Duration
 }
 
 func (h cueHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -101,13 +179,86 @@ func (h cueHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		Action: "cue",
 		Target: req.URL.Path,
 	}
-	_, err := h.Cmd([]disco.Cmd{cmd})
-	if err != nil {
-		slog.Error(err.Error())
+	ctx, cancel := context.WithTimeout(req.Context(), h.timeout)
+	defer cancel()
+	ctx, rs := disco.WithResults(ctx)
+	cmds, err := h.Cmd(ctx, []disco.Cmd{cmd})
+	for _, c := range cmds {
+		if c.Action == "request" {
+			slog.Info("dry run", "cue", cmd.Target, "request", c)
+		}
+	}
+	for _, e := range disco.AsErrors(err) {
+		if e.Backend != "" {
+			// reported with the results
+			continue
+		}
+		slog.Error(e.Err.Error(), "cue", cmd.Target)
+	}
+	for _, r := range rs.List() {
+		switch r.Status {
+		case disco.Applied:
+			slog.Debug("applied", "cue", cmd.Target, "cmd", r.Cmd, "device", r.Device)
+			continue
+		case disco.Held, disco.Skipped:
+			slog.Info(r.Status.String(), "cue", cmd.Target, "cmd", r.Cmd, "device", r.Device, "reason", r.Err)
+			continue
+		}
+		slog.Warn(r.Status.String(), "cue", cmd.Target, "cmd", r.Cmd, "device", r.Device, "error", r.Err)
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+type recordHandler struct {
+	disco.Cmdr
+	cuer    disco.Cuer
+	config  *backend.Config
+	file    string
+	timeout time.Duration
+	dryRun  bool
+}
+
+func (h recordHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var call disco.Call
+	for _, p := range h.config.Sheet {
+		for _, s := range p.Sections {
+			for _, g := range s.Group {
+				for _, c := range g {
+					if c.Record == req.URL.Path {
+						call = c
+					}
+				}
+			}
+		}
+	}
+	if call.Record == "" {
+		http.Error(w, "Ce cue n'existe pas !", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), h.timeout)
+	defer cancel()
+	cue := disco.Cue{Text: call.Text}
+	cmds, err := disco.Record(ctx, h, disco.WithLink(nil, h.config.Link), call.Targets)
+	if err != nil {
+		slog.Error(err.Error(), "record", call.Record)
+		http.Error(w, fmt.Sprintf("Error: %s", err), http.StatusInternalServerError)
+		return
+	}
+	cue.Cmds = cmds
+	if h.dryRun {
+		slog.Info("dry run", "record", call.Record, "cmds", cmds)
+	} else if err := backend.AddCue(h.file, call.Record, cue); err != nil {
+		slog.Error(err.Error(), "record", call.Record)
+		http.Error(w, fmt.Sprintf("Error: %s", err), http.StatusInternalServerError)
+		return
+	}
+	h.cuer.SetCue(call.Record, cue)
+	slog.Info("recorded", "cue", call.Record, "cmds", cmds)
+	page := "/" + url.PathEscape(req.PostFormValue("page"))
+	http.Redirect(w, req, page, http.StatusFound)
+}
+
 type chaseHandler struct {
 	disco.Chaser
 }
@@ -169,6 +320,22 @@ func (w *statusLogger) WriteHeader(status int) {
 	w.log(status)
 }
 
+// watchHandler reports the subscribers of the shared watch stream and how far
+// each one is behind.
+type watchHandler struct {
+	*disco.MultiWatcher
+}
+
+func (h watchHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "id\tlag\tmaxlag\tsent\tdropped\tcoalesced")
+	for _, s := range h.Stats() {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%d\n", s.Id, s.Lag, s.MaxLag, s.Sent, s.Dropped, s.Coalesced)
+	}
+	tw.Flush()
+}
+
 type logTailHandler struct {
 	*template.Template
 	logs  []byte
@@ -207,14 +374,22 @@ var files embed.FS
 var logLevel = new(slog.LevelVar)
 
 type flags struct {
-	config string
-	listen string
+	config    string
+	listen    string
+	timeout   time.Duration
+	dryRun    bool
+	cache     time.Duration
+	reconcile string
 }
 
 func main() {
 	var f flags
 	flag.StringVar(&f.config, "c", "/etc/disco.yml", "path to config `file`")
 	flag.StringVar(&f.listen, "l", ":80", "listen `address`")
+	flag.DurationVar(&f.timeout, "t", 10*time.Second, "cue `timeout`")
+	flag.DurationVar(&f.cache, "s", 0, "answer getters from a cache refreshed at least every `duration`, 0 to turn off")
+	flag.StringVar(&f.reconcile, "r", "", "set lights back when they come back or drift, `exclude`, `adopt` or `revert` manual changes")
+	flag.BoolVar(&f.dryRun, "n", false, "dry run, log requests instead of sending them")
 	flag.TextVar(logLevel, "v", logLevel, "log `level`")
 	flag.Parse()
 
@@ -247,7 +422,34 @@ func main() {
 	}
 	defer backend.Shutdown()
 
-	cmdr := disco.New(cmdrs, cfg.Config)
+	mw := disco.Multi(cmdrs)
+	http.Handle("/watch", logHandler{watchHandler{mw}})
+	var backends disco.Cmdr = mw
+	if f.cache > 0 {
+		c := disco.WithCache(backends, f.cache)
+		defer c.Close()
+		backends = c
+	}
+	if f.reconcile != "" {
+		m, err := disco.ParseManual(f.reconcile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		r := disco.WithReconcile(backends, m)
+		go func() {
+			for {
+				err := r.Run(context.Background())
+				slog.Warn("reconcile watch dropped", "error", err)
+				time.Sleep(10 * time.Second)
+			}
+		}()
+		backends = r
+	}
+	cuer := disco.New(backends, cfg.Config)
+	var cmdr disco.Cmdr = cuer
+	if f.dryRun {
+		cmdr = disco.DryRun{Cmdr: cmdr}
+	}
 
 	b, err = files.ReadFile("disco.html")
 	if err != nil {
@@ -271,7 +473,7 @@ func main() {
 	http.Handle("/favicon.ico", fs)
 	http.Handle("/manifest.json", fs)
 
-	ch := logHandler{http.StripPrefix("/cue/", cueHandler{cmdr})}
+	ch := logHandler{http.StripPrefix("/cue/", cueHandler{cmdr, f.timeout})}
 	http.Handle("/cue/", ch)
 
 	chsr, errs := disco.NewChaser(cmdr, cfg.Chase)
@@ -283,7 +485,19 @@ func main() {
 	sh := logHandler{http.StripPrefix("/chase/", chaseHandler{chsr})}
 	http.Handle("/chase/", sh)
 
-	ph := logHandler{pageHandler{t, page{cfg.Config, chsr}}}
+	rh := logHandler{http.StripPrefix("/record/", recordHandler{cmdr, cuer, cfg, f.config, f.timeout, f.dryRun})}
+	http.Handle("/record/", rh)
+
+	rc := newReach()
+	go func() {
+		for {
+			err := rc.watch(context.Background(), cuer)
+			slog.Warn("status watch dropped", "error", err)
+			time.Sleep(10 * time.Second)
+		}
+	}()
+
+	ph := logHandler{pageHandler{t, page{cfg.Config, cuer, chsr, rc}}}
 	http.Handle("/", ph)
 	log.Fatal(http.ListenAndServe(f.listen, nil))
 }
@@ -110,6 +110,19 @@ func (c Color) Kf() float64 {
 	return float64(uint8(c>>24)-1) / (math.MaxUint8 - 1)
 }
 
+// WithKf returns a new Color with the color temperature component set from k on
+// the range 0.0 to 1.0. The inverse of Kf.
+func (c Color) WithKf(k float64) Color {
+	k = max(min(k, 1.0), 0.0)
+	return c&0xffffff | Color(1+math.Round(k*(math.MaxUint8-1)))<<24
+}
+
+// Kelvin converts a color temperature in kelvin to an approximate Color. The
+// color temperature component is not set.
+func Kelvin(t float64) Color {
+	return RGBf(KelvintoRGB(t))
+}
+
 // RGBf converts red, green, and blue float64 values on the range of 0.0 to 1.0
 // to a Color. The inputs are clamped to the range of 0.0 to 1.0
 func RGBf(r, g, b float64) (c Color) {
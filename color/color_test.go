@@ -0,0 +1,28 @@
+package color
+
+import "testing"
+
+func TestWithKf(t *testing.T) {
+	var zs = []struct {
+		c  Color
+		k  float64
+		ex Color
+	}{
+		{0xff8000, 0.0, 0x01ff8000},
+		{0xff8000, 1.0, 0xffff8000},
+		{0x7fff8000, 0.5, 0x80ff8000},
+		{0x000000, 2.0, 0xff000000},
+	}
+	for _, z := range zs {
+		c := z.c.WithKf(z.k)
+		if c != z.ex {
+			t.Errorf("%x %f: expected %x got %x", z.c, z.k, z.ex, c)
+		}
+	}
+	for i := 1; i <= 0xff; i++ {
+		c := Color(i << 24)
+		if k := c.WithKf(c.Kf()); k != c {
+			t.Errorf("%x: expected round trip got %x", c, k)
+		}
+	}
+}
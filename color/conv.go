@@ -134,6 +134,35 @@ func gammaReverse(f float64) float64 {
 	return (1.055)*math.Pow(f, (1.0/2.4)) - 0.055
 }
 
+// KelvintoRGB converts a black body color temperature in kelvin to red, green,
+// and blue floating point values on the range 0.0 to 1.0. The approximation
+// is fitted to the range 1000K to 40000K.
+func KelvintoRGB(t float64) (r, g, b float64) {
+	t = max(min(t, 40000), 1000) / 100
+
+	if t <= 66 {
+		r = 1.0
+		g = (99.4708025861*math.Log(t) - 161.1195681661) / 255
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592) / 255
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492) / 255
+	}
+
+	switch {
+	case t >= 66:
+		b = 1.0
+	case t <= 19:
+		b = 0.0
+	default:
+		b = (138.5177312231*math.Log(t-10) - 305.0447927307) / 255
+	}
+
+	r = max(min(r, 1.0), 0.0)
+	g = max(min(g, 1.0), 0.0)
+	b = max(min(b, 1.0), 0.0)
+	return
+}
+
 // BoundToGamutXY compares the point x,y to the triangle formed by rx,ry, gx,gy,
 // bx,by. If the point falls within the triangle, x and y are returned. If the
 // point falls outside the triangle, the x and y values of the nearest point
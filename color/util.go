@@ -44,3 +44,37 @@ func wrap(h float64) float64 {
 	}
 	return h
 }
+
+// Rotate returns c with its hue rotated by turns of the color wheel.
+func (c Color) Rotate(turns float64) Color {
+	h, s, v := c.HSVf()
+	return HSVf(wrap(h+turns), s, v)
+}
+
+// Saturate returns c with d added to its saturation, which is clamped to the
+// range of 0.0 to 1.0. A negative d desaturates.
+func (c Color) Saturate(d float64) Color {
+	h, s, v := c.HSVf()
+	return HSVf(h, max(min(s+d, 1.0), 0.0), v)
+}
+
+// Shift returns the color f of the way from c to d, on the range of 0.0 to
+// 1.0, interpolating in HSV colorspace like Seq.
+func (c Color) Shift(d Color, f float64) Color {
+	h0, s0, v0 := c.HSVf()
+	h1, s1, v1 := d.HSVf()
+
+	switch {
+	case h1-h0 > 0.5:
+		h0 += 1.0
+	case h1-h0 < -0.5:
+		h1 += 1.0
+	}
+
+	f = max(min(f, 1.0), 0.0)
+	return HSVf(
+		wrap(h0+(h1-h0)*f),
+		s0+(s1-s0)*f,
+		v0+(v1-v0)*f,
+	)
+}
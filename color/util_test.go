@@ -0,0 +1,57 @@
+package color
+
+import "testing"
+
+func TestRotate(t *testing.T) {
+	var zs = []struct {
+		c     Color
+		turns float64
+		ex    Color
+	}{
+		{0xff0000, 1.0 / 3, 0x00ff00},
+		{0xff0000, -0.5, 0x00ffff},
+		{0xff0000, 1.25, 0x7fff00},
+		{0x808080, 0.5, 0x808080},
+	}
+	for _, z := range zs {
+		if c := z.c.Rotate(z.turns); c != z.ex {
+			t.Errorf("%06x %f: expected %06x got %06x", uint32(z.c), z.turns, uint32(z.ex), uint32(c))
+		}
+	}
+}
+
+func TestSaturate(t *testing.T) {
+	var zs = []struct {
+		c  Color
+		d  float64
+		ex Color
+	}{
+		{0x00ffff, -0.5, 0x7fffff},
+		{0x7fffff, 1.0, 0x00ffff},
+		{0x808080, 0.5, 0x804040},
+		{0xff0000, -2.0, 0xffffff},
+	}
+	for _, z := range zs {
+		if c := z.c.Saturate(z.d); c != z.ex {
+			t.Errorf("%06x %f: expected %06x got %06x", uint32(z.c), z.d, uint32(z.ex), uint32(c))
+		}
+	}
+}
+
+func TestShift(t *testing.T) {
+	var zs = []struct {
+		c, d Color
+		f    float64
+		ex   Color
+	}{
+		{0x00ff00, 0x0000ff, 0.5, 0x00ffff},
+		{0xff0000, 0xff00ff, 0.5, 0xff007f},
+		{0xff0000, 0x0000ff, 0.0, 0xff0000},
+		{0xff0000, 0x0000ff, 2.0, 0x0000ff},
+	}
+	for _, z := range zs {
+		if c := z.c.Shift(z.d, z.f); c != z.ex {
+			t.Errorf("%06x %06x %f: expected %06x got %06x", uint32(z.c), uint32(z.d), z.f, uint32(z.ex), uint32(c))
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math/rand"
 	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,15 +22,34 @@ type Config struct {
 	Cue   map[string]Cue
 	Chase map[string]Chase
 	Sheet []Page
+
+	// History is the number of calls that can be undone, DefaultHistory if
+	// zero. Undo is off if it is negative.
+	History int
+
+	// Snapshots is the file snapshots are saved to. Snapshots are kept in
+	// memory only if it is empty.
+	Snapshots string
+
+	// Toggle is the rule for toggling a link, ToggleAny if empty.
+	Toggle string
 }
 
 type Cmdr interface {
-	Cmd(cmds []Cmd) ([]Cmd, error)
+	Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error)
 	Watch(ctx context.Context) (<-chan Cmd, error)
 }
 
-func New(c Cmdr, cfg Config) Cmdr {
-	return WithCue(WithSplay(WithLink(WithMap(c, cfg.Map), cfg.Link), cfg.Link), cfg.Cue)
+func New(c Cmdr, cfg Config) Cuer {
+	m := WithMaster(WithBlackout(WithMap(c, cfg.Map)), cfg.Link)
+	c = WithSplay(WithLink(WithRelative(WithPark(m)), cfg.Link), cfg.Link)
+	c = WithMasters(c, m)
+	n := cfg.History
+	if n == 0 {
+		n = DefaultHistory
+	}
+	c = WithToggle(WithHistory(c, n), cfg.Toggle)
+	return WithCue(WithSnapshot(c, cfg.Snapshots), cfg.Cue)
 }
 
 type Cmd struct {
@@ -86,6 +106,15 @@ func SwitchCmd(target string, on bool) Cmd {
 	)
 }
 
+// StatusCmd reports whether a device is reachable.
+func StatusCmd(target string, reachable bool) Cmd {
+	return newCmd(
+		"status",
+		target,
+		map[bool]string{true: "reachable", false: "unreachable"}[reachable],
+	)
+}
+
 func ParseSwitch(s string) (bool, error) {
 	switch s {
 	case "on":
@@ -130,19 +159,132 @@ func ColorCmd(target string, c color.Color) Cmd {
 	)
 }
 
+// ErrNotFound is returned by backends for a target they do not have.
+var ErrNotFound = errors.New("not found")
+
+// Error attributes an error to the backend and target it occurred on.
+type Error struct {
+	Backend string
+	Target  string
+	Err     error
+}
+
+// TargetErr attributes err to target.
+func TargetErr(target string, err error) error {
+	return &Error{Target: target, Err: err}
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Target != "":
+		return e.Target + ": " + e.Err.Error()
+	case e.Backend != "":
+		return e.Backend + ": " + e.Err.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors is a list of errors attributed to backends and targets.
+type Errors []*Error
+
+func (es Errors) Error() string {
+	s := make([]string, len(es))
+	for i, e := range es {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+func (es Errors) Unwrap() []error {
+	errs := make([]error, len(es))
+	for i, e := range es {
+		errs[i] = e
+	}
+	return errs
+}
+
+// AsErrors flattens err into Errors. Joined errors are split and errors not
+// attributed to a target are wrapped in an Error.
+func AsErrors(err error) Errors {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) && e == err {
+		return Errors{e}
+	}
+	if u, ok := err.(interface{ Unwrap() []error }); ok {
+		var es Errors
+		for _, err := range u.Unwrap() {
+			es = append(es, AsErrors(err)...)
+		}
+		return es
+	}
+	return Errors{{Err: err}}
+}
+
+func (es Errors) err() error {
+	if len(es) == 0 {
+		return nil
+	}
+	return es
+}
+
 type Cmdrs []Cmdr
 
-func (cs Cmdrs) Cmd(cmds []Cmd) ([]Cmd, error) {
+// Cmd runs cmds on every Cmdr concurrently.
+func (cs Cmdrs) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
 	var (
-		couts []Cmd
-		errs  error
+		couts = make([][]Cmd, len(cs))
+		errs  = make([]error, len(cs))
+		wg    = &sync.WaitGroup{}
 	)
-	for _, c := range cs {
-		cout, err := c.Cmd(cmds)
-		couts = append(couts, cout...)
-		errs = errors.Join(errs, err)
+	if tracing(ctx) || recording(ctx) {
+		cs.dropped(ctx, cmds)
+	}
+	for i, c := range cs {
+		wg.Add(1)
+		go func() {
+			couts[i], errs[i] = c.Cmd(ctx, slices.Clone(cmds))
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	var (
+		cout []Cmd
+		es   Errors
+	)
+	for i := range cs {
+		cout = append(cout, couts[i]...)
+		es = append(es, AsErrors(errs[i])...)
+	}
+	return cout, es.err()
+}
+
+var errNoBackend = errors.New("no backend")
+
+// dropped records a step and a result for each of cmds that no Cmdr accepts.
+// A Cmdr without an Accepts method accepts everything.
+func (cs Cmdrs) dropped(ctx context.Context, cmds []Cmd) {
+	for _, cmd := range cmds {
+		accepted := cmd.Target == ""
+		for _, c := range cs {
+			a, ok := c.(interface{ Accepts(string) bool })
+			if !ok || a.Accepts(cmd.Target) {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			trace(ctx, Step{Stage: "backend", In: cmd, Note: "dropped, no backend"})
+			record(ctx, Result{Cmd: cmd, Device: cmd.Target, Status: Skipped, Err: errNoBackend})
+		}
 	}
-	return couts, errs
 }
 
 func (cs Cmdrs) Watch(ctx context.Context) (<-chan Cmd, error) {
@@ -184,20 +326,44 @@ func WithPrefix(c Cmdr, prefix string) Prefixer {
 	return Prefixer{c, prefix}
 }
 
-func (p Prefixer) Cmd(cmds []Cmd) ([]Cmd, error) {
+// Accepts reports whether commands for target are passed to the Cmdr.
+func (p Prefixer) Accepts(target string) bool {
+	return target == "" || strings.HasPrefix(target, p.Prefix)
+}
+
+func (p Prefixer) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
 	var cuts []Cmd
 	for _, cmd := range cmds {
-		target, ok := strings.CutPrefix(cmd.Target, p.Prefix)
-		if ok || target == "" {
-			cmd.Target = target
-			cuts = append(cuts, cmd)
+		if !p.Accepts(cmd.Target) {
+			continue
+		}
+		cut := cmd
+		cut.Target = strings.TrimPrefix(cmd.Target, p.Prefix)
+		cuts = append(cuts, cut)
+		if cmd.Target != "" {
+			trace(ctx, Step{Stage: "backend", In: cmd, Out: []Cmd{cut}, Note: strings.TrimSuffix(p.Prefix, "/")})
 		}
 	}
-	cout, err := p.Cmdr.Cmd(cuts)
+	cout, err := p.Cmdr.Cmd(ctx, cuts)
 	for i := range cout {
 		cout[i].Target = p.Prefix + cout[i].Target
 	}
-	return cout, err
+	es := AsErrors(err)
+	for _, e := range es {
+		if e.Backend == "" {
+			e.Backend = strings.TrimSuffix(p.Prefix, "/")
+		}
+		if e.Target != "" {
+			e.Target = p.Prefix + e.Target
+		}
+	}
+	for i := range cuts {
+		if cuts[i].Target != "" {
+			cuts[i].Target = p.Prefix + cuts[i].Target
+		}
+	}
+	recordResults(ctx, cuts, es)
+	return cout, es.err()
 }
 
 func (p Prefixer) Watch(ctx context.Context) (<-chan Cmd, error) {
@@ -216,6 +382,25 @@ func (p Prefixer) Watch(ctx context.Context) (<-chan Cmd, error) {
 	return cout, nil
 }
 
+// Timeout limits the time the Cmdr has to complete each call.
+type Timeout struct {
+	Cmdr
+	D time.Duration
+}
+
+func WithTimeout(c Cmdr, d time.Duration) Timeout {
+	return Timeout{c, d}
+}
+
+func (t Timeout) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	if t.D <= 0 {
+		return t.Cmdr.Cmd(ctx, cmds)
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.D)
+	defer cancel()
+	return t.Cmdr.Cmd(ctx, cmds)
+}
+
 type Linker struct {
 	Cmdr
 	L map[string][]string
@@ -225,29 +410,170 @@ func WithLink(c Cmdr, l map[string][]string) Linker {
 	return Linker{c, l}
 }
 
-func (l Linker) Cmd(cmds []Cmd) ([]Cmd, error) {
+func (l Linker) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var links []Cmd
+	for _, cmd := range cmds {
+		targets, err := l.expand(cmd.Target, nil)
+		if err != nil {
+			return nil, err
+		}
+		if tracing(ctx) && (len(targets) != 1 || targets[0].target != cmd.Target) {
+			traceLinks(ctx, cmd, targets)
+		}
+		for _, t := range targets {
+			c := cmd
+			c.Target = t.target
+			links = append(links, c)
+		}
+	}
+	return l.Cmdr.Cmd(ctx, dedupe(ctx, links))
+}
+
+// Expand resolves target to the targets it links to, depth first in the order
+// they are linked. Targets linked more than once appear once.
+func (l Linker) Expand(target string) ([]string, error) {
+	targets, err := l.expand(target, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, t := range targets {
+		if !slices.Contains(out, t.target) {
+			out = append(out, t.target)
+		}
+	}
+	return out, nil
+}
+
+// Compress replaces commands for every target of a link with one command for
+// the link where they all have the same args. Larger links are tried first.
+func (l Linker) Compress(cmds []Cmd) []Cmd {
+	type group struct {
+		cmd     Cmd
+		targets []string
+	}
+	var groups []*group
+	for _, cmd := range cmds {
+		i := slices.IndexFunc(groups, func(g *group) bool {
+			return g.cmd.Action == cmd.Action && slices.Equal(g.cmd.Args, cmd.Args)
+		})
+		if i < 0 {
+			groups = append(groups, &group{cmd: cmd})
+			i = len(groups) - 1
+		}
+		groups[i].targets = append(groups[i].targets, cmd.Target)
+	}
+
+	links := map[string][]string{}
+	for k := range l.L {
+		if ts, err := l.Expand(k); err == nil {
+			links[k] = ts
+		}
+	}
+	names := sortedKeys(links)
+	sort.SliceStable(names, func(i, j int) bool {
+		return len(links[names[i]]) > len(links[names[j]])
+	})
+
+	var out []Cmd
+	for _, g := range groups {
+		remaining := slices.Clone(g.targets)
+		var targets []string
+		for _, k := range names {
+			covered := len(links[k]) > 1
+			for _, t := range links[k] {
+				covered = covered && slices.Contains(remaining, t)
+			}
+			if !covered {
+				continue
+			}
+			targets = append(targets, k)
+			remaining = slices.DeleteFunc(remaining, func(t string) bool {
+				return slices.Contains(links[k], t)
+			})
+		}
+		sort.Strings(remaining)
+		for _, t := range append(targets, remaining...) {
+			cmd := g.cmd
+			cmd.Target = t
+			out = append(out, cmd)
+		}
+	}
+	return out
+}
+
+// linked is a target and the links it was resolved through.
+type linked struct {
+	target string
+	via    []string
+}
+
+func (l Linker) expand(target string, path []string) ([]linked, error) {
+	if slices.Contains(path, target) {
+		return nil, cycleErr("link", append(path, target))
+	}
+	links, ok := l.L[target]
+	if !ok {
+		return []linked{{target, path}}, nil
+	}
+	path = append(path[:len(path):len(path)], target)
+	var targets []linked
+	for _, link := range links {
+		ts, err := l.expand(link, path)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, ts...)
+	}
+	return targets, nil
+}
+
+// traceLinks records a step for each chain of links cmd was resolved through.
+func traceLinks(ctx context.Context, cmd Cmd, targets []linked) {
 	var (
-		links []Cmd
-		again = true
+		vias []string
+		outs = map[string][]Cmd{}
 	)
-	for again {
-		links = []Cmd{}
-		again = false
-		for _, cmd := range cmds {
-			targets, ok := l.L[cmd.Target]
-			if ok {
-				again = true
-				for _, target := range targets {
-					cmd.Target = target
-					links = append(links, cmd)
-				}
-			} else {
-				links = append(links, cmd)
-			}
+	for _, t := range targets {
+		via := strings.Join(t.via, " -> ")
+		if _, ok := outs[via]; !ok {
+			vias = append(vias, via)
+		}
+		c := cmd
+		c.Target = t.target
+		outs[via] = append(outs[via], c)
+	}
+	for _, via := range vias {
+		note := "link " + via
+		if via == "" {
+			note = "not a link"
+		}
+		trace(ctx, Step{Stage: "link", In: cmd, Out: outs[via], Note: note})
+	}
+}
+
+func cycleErr(kind string, path []string) error {
+	return fmt.Errorf("%s cycle: %s", kind, strings.Join(path, " -> "))
+}
+
+// dedupe removes commands with the same action and target as a later command
+// so the last one wins.
+func dedupe(ctx context.Context, cmds []Cmd) []Cmd {
+	var (
+		seen = map[[2]string]bool{}
+		out  []Cmd
+	)
+	for i := len(cmds) - 1; i >= 0; i-- {
+		k := [2]string{cmds[i].Action, cmds[i].Target}
+		if seen[k] {
+			trace(ctx, Step{Stage: "link", In: cmds[i], Note: "dropped, overridden by a later command"})
+			continue
 		}
-		cmds = links
+		seen[k] = true
+		out = append(out, cmds[i])
 	}
-	return l.Cmdr.Cmd(cmds)
+	slices.Reverse(out)
+	return out
 }
 
 type Splay struct {
@@ -259,7 +585,7 @@ func WithSplay(c Cmdr, l map[string][]string) Splay {
 	return Splay{c, l}
 }
 
-func (s Splay) Cmd(cmds []Cmd) ([]Cmd, error) {
+func (s Splay) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
 	var splays []Cmd
 	for _, cmd := range cmds {
 		if cmd.Action != "splay" && cmd.Action != "shuffle" {
@@ -280,6 +606,7 @@ func (s Splay) Cmd(cmds []Cmd) ([]Cmd, error) {
 				colors[i], colors[j] = colors[j], colors[i]
 			})
 		}
+		n := len(splays)
 		for i := 0; i < len(targets); i++ {
 			c := ColorCmd(targets[i], colors[i])
 			if len(cmd.Args) > 2 {
@@ -287,12 +614,13 @@ func (s Splay) Cmd(cmds []Cmd) ([]Cmd, error) {
 			}
 			splays = append(splays, c)
 		}
+		trace(ctx, Step{Stage: "splay", In: cmd, Out: splays[n:], Note: "link " + cmd.Target})
 	}
 	cmds = slices.DeleteFunc(cmds, func(cmd Cmd) bool {
 		return cmd.Action == "splay" || cmd.Action == "shuffle"
 	})
 	cmds = append(cmds, splays...)
-	return s.Cmdr.Cmd(cmds)
+	return s.Cmdr.Cmd(ctx, cmds)
 }
 
 type Mapper struct {
@@ -313,13 +641,21 @@ func WithMap(c Cmdr, m map[string]string) Mapper {
 	return p
 }
 
-func (m Mapper) Cmd(cmds []Cmd) ([]Cmd, error) {
+func (m Mapper) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	ctx = withRecorder(ctx, func(r Result) Result {
+		if target, ok := m.M[r.Cmd.Target]; ok {
+			r.Cmd.Target = target
+		}
+		return r
+	})
 	for i := range cmds {
 		if target, ok := m.m[cmds[i].Target]; ok {
+			in := cmds[i]
 			cmds[i].Target = target
+			trace(ctx, Step{Stage: "map", In: in, Out: []Cmd{cmds[i]}, Note: "map " + target + ": " + in.Target})
 		}
 	}
-	cmds, err := m.Cmdr.Cmd(cmds)
+	cmds, err := m.Cmdr.Cmd(ctx, cmds)
 	for i := range cmds {
 		if target, ok := m.M[cmds[i].Target]; ok {
 			cmds[i].Target = target
@@ -346,11 +682,41 @@ func (m Mapper) Watch(ctx context.Context) (<-chan Cmd, error) {
 	return cout, nil
 }
 
+// Policy is what a MultiWatcher does when a subscriber's buffer is full.
+type Policy int
+
+const (
+	// DropOldest drops the oldest buffered change to make room.
+	DropOldest Policy = iota
+	// Coalesce keeps only the latest change for each action and target, and
+	// drops the oldest when the buffer is still full.
+	Coalesce
+	// Disconnect closes the subscriber's channel.
+	Disconnect
+)
+
+type policyKey struct{}
+
+// WithPolicy returns a context that subscribes to a MultiWatcher with p
+// instead of the MultiWatcher's Policy.
+func WithPolicy(ctx context.Context, p Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+// DefaultBuffer is the number of changes buffered for each subscriber if the
+// MultiWatcher's Buffer is not set.
+const DefaultBuffer = 64
+
+// MultiWatcher shares one Watch of the Cmdr between many subscribers. Each
+// subscriber has its own buffer, so a slow one does not hold up the others.
 type MultiWatcher struct {
 	Cmdr
+	Buffer int
+	Policy Policy
 
 	mu     *sync.Mutex
-	cs     map[context.Context]chan Cmd
+	cs     map[context.Context]*subscriber
+	n      int
 	cancel func()
 }
 
@@ -358,46 +724,199 @@ func Multi(c Cmdr) *MultiWatcher {
 	return &MultiWatcher{
 		Cmdr:   c,
 		mu:     &sync.Mutex{},
-		cs:     map[context.Context]chan Cmd{},
+		cs:     map[context.Context]*subscriber{},
 		cancel: func() {},
 	}
 }
 
+// WatchStats are the metrics of one subscriber of a MultiWatcher.
+type WatchStats struct {
+	Id int
+	// Lag is the number of changes buffered and not yet received.
+	Lag       int
+	MaxLag    int
+	Sent      uint64
+	Dropped   uint64
+	Coalesced uint64
+}
+
+// Stats returns the metrics of every subscriber.
+func (m *MultiWatcher) Stats() []WatchStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ss []WatchStats
+	for _, s := range m.cs {
+		s.mu.Lock()
+		st := s.stats
+		st.Lag = len(s.queue)
+		s.mu.Unlock()
+		ss = append(ss, st)
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Id < ss[j].Id })
+	return ss
+}
+
 func (m *MultiWatcher) Watch(ctx context.Context) (<-chan Cmd, error) {
 	m.mu.Lock()
+	defer m.mu.Unlock()
 	if len(m.cs) == 0 {
-		ctx, cancel := context.WithCancel(context.Background())
-		c, err := m.Cmdr.Watch(ctx)
+		uctx, cancel := context.WithCancel(context.Background())
+		c, err := m.Cmdr.Watch(uctx)
 		if err != nil {
 			cancel()
 			return c, err
 		}
-		go func(c <-chan Cmd) {
-			for cmd := range c {
-				m.mu.Lock()
-				for _, c := range m.cs {
-					c <- cmd
-				}
-				m.mu.Unlock()
-			}
-		}(c)
+		go m.fan(c)
 		m.cancel = cancel
 	}
-	c := make(chan Cmd)
-	m.cs[ctx] = c
-	m.mu.Unlock()
 
-	go func(ctx context.Context, c chan Cmd) {
+	size := m.Buffer
+	if size <= 0 {
+		size = DefaultBuffer
+	}
+	policy := m.Policy
+	if p, ok := ctx.Value(policyKey{}).(Policy); ok {
+		policy = p
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	m.n++
+	s := &subscriber{
+		out:    make(chan Cmd),
+		size:   size,
+		policy: policy,
+		mu:     &sync.Mutex{},
+		notify: make(chan struct{}, 1),
+		cancel: cancel,
+		stats:  WatchStats{Id: m.n},
+	}
+	m.cs[ctx] = s
+	go s.pump(ctx)
+
+	go func() {
 		<-ctx.Done()
 		m.mu.Lock()
-		delete(m.cs, ctx)
-		if len(m.cs) == 0 {
-			m.cancel()
+		if m.cs[ctx] == s {
+			delete(m.cs, ctx)
+			if len(m.cs) == 0 {
+				m.cancel()
+			}
+		}
+		m.mu.Unlock()
+	}()
+	return s.out, nil
+}
+
+// fan passes each change to every subscriber without waiting for any of them.
+func (m *MultiWatcher) fan(c <-chan Cmd) {
+	for cmd := range c {
+		m.mu.Lock()
+		for _, s := range m.cs {
+			s.push(cmd)
 		}
 		m.mu.Unlock()
-		close(c)
-	}(ctx, c)
-	return c, nil
+	}
+	m.mu.Lock()
+	for _, s := range m.cs {
+		s.close()
+	}
+	// the next subscriber starts the upstream again
+	m.cs = map[context.Context]*subscriber{}
+	m.mu.Unlock()
+}
+
+type subscriber struct {
+	out    chan Cmd
+	size   int
+	policy Policy
+
+	mu     *sync.Mutex
+	queue  []Cmd
+	done   bool
+	notify chan struct{}
+	cancel func()
+	stats  WatchStats
+}
+
+func (s *subscriber) push(cmd Cmd) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return
+	}
+	if s.policy == Coalesce {
+		i := slices.IndexFunc(s.queue, func(c Cmd) bool {
+			return c.Action == cmd.Action && c.Target == cmd.Target
+		})
+		if i >= 0 {
+			s.queue[i] = cmd
+			s.stats.Coalesced++
+			return
+		}
+	}
+	if len(s.queue) >= s.size {
+		if s.policy == Disconnect {
+			s.done = true
+			s.queue = nil
+			s.cancel()
+			return
+		}
+		s.queue = s.queue[1:]
+		s.stats.Dropped++
+	}
+	s.queue = append(s.queue, cmd)
+	s.stats.MaxLag = max(s.stats.MaxLag, len(s.queue))
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// close ends the subscription once the buffer has been received.
+func (s *subscriber) close() {
+	s.mu.Lock()
+	s.done = true
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) pump(ctx context.Context) {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		var (
+			cmd  Cmd
+			ok   = len(s.queue) > 0
+			done = s.done
+		)
+		if ok {
+			cmd = s.queue[0]
+			s.queue = s.queue[1:]
+		}
+		s.mu.Unlock()
+
+		switch {
+		case ok:
+			select {
+			case s.out <- cmd:
+				s.mu.Lock()
+				s.stats.Sent++
+				s.mu.Unlock()
+			case <-ctx.Done():
+				return
+			}
+		case done:
+			return
+		default:
+			select {
+			case <-s.notify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
 }
 
 type Cue struct {
@@ -408,32 +927,66 @@ type Cue struct {
 type Cuer struct {
 	Cmdr
 	Cues map[string]Cue
+	mu   *sync.RWMutex
 }
 
 func WithCue(c Cmdr, q map[string]Cue) Cuer {
-	return Cuer{c, q}
+	return Cuer{c, q, &sync.RWMutex{}}
 }
 
-func (c Cuer) Cmd(cmds []Cmd) ([]Cmd, error) {
-	var (
-		again = true
-	)
-	for again {
-		again = false
-		for i, cmd := range cmds {
-			if cmd.Action != "cue" {
-				continue
-			}
-			cue, ok := c.Cues[cmd.Target]
-			if !ok {
-				return nil, fmt.Errorf("cue not found: %q", cmd.Target)
-			}
-			cmds = slices.Replace(cmds, i, i+1, cue.Cmds...)
-			again = true
-			break
+// Cue returns the cue named s.
+func (c Cuer) Cue(s string) (Cue, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cue, ok := c.Cues[s]
+	return cue, ok
+}
+
+// SetCue adds or replaces the cue named s.
+func (c Cuer) SetCue(s string, cue Cue) {
+	c.mu.Lock()
+	c.Cues[s] = cue
+	c.mu.Unlock()
+}
+
+func (c Cuer) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var cues []Cmd
+	for _, cmd := range cmds {
+		c.mu.RLock()
+		cs, err := c.expand(cmd, nil)
+		c.mu.RUnlock()
+		if err != nil {
+			return nil, err
 		}
+		if cmd.Action == "cue" {
+			trace(ctx, Step{Stage: "cue", In: cmd, Out: cs, Note: "cue " + cmd.Target})
+		}
+		cues = append(cues, cs...)
 	}
-	return c.Cmdr.Cmd(cmds)
+	return c.Cmdr.Cmd(ctx, cues)
+}
+
+func (c Cuer) expand(cmd Cmd, path []string) ([]Cmd, error) {
+	if cmd.Action != "cue" {
+		return []Cmd{cmd}, nil
+	}
+	if slices.Contains(path, cmd.Target) {
+		return nil, cycleErr("cue", append(path, cmd.Target))
+	}
+	cue, ok := c.Cues[cmd.Target]
+	if !ok {
+		return nil, fmt.Errorf("cue not found: %q", cmd.Target)
+	}
+	path = append(path[:len(path):len(path)], cmd.Target)
+	var cmds []Cmd
+	for _, cmd := range cue.Cmds {
+		cs, err := c.expand(cmd, path)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cs...)
+	}
+	return cmds, nil
 }
 
 type Chase struct {
@@ -471,11 +1024,11 @@ func (c Chaser) Chase(s string) {
 		return
 	}
 
-	done := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = context.WithValue(ctx, noHistoryKey{}, true)
+	ctx = context.WithValue(ctx, chaseKey{}, true)
 	c.mu.Lock()
-	c.stop[s] = func() {
-		close(done)
-	}
+	c.stop[s] = cancel
 	c.mu.Unlock()
 
 	go func() {
@@ -487,7 +1040,7 @@ func (c Chaser) Chase(s string) {
 		for {
 			select {
 			case <-run:
-			case <-done:
+			case <-ctx.Done():
 				return
 			}
 
@@ -503,9 +1056,21 @@ func (c Chaser) Chase(s string) {
 				}
 			}
 
-			_, err := c.Cmd(steps)
-			if err != nil {
-				c.errs <- fmt.Errorf("chase %s step %d wait: %w", s, step, err)
+			// A step gets until the next step is due, stopping the chase
+			// aborts it.
+			sctx, scancel := ctx, context.CancelFunc(func() {})
+			if wait > 0 {
+				sctx, scancel = context.WithTimeout(ctx, wait)
+			}
+			_, err := c.Cmd(sctx, steps)
+			scancel()
+			if errors.Is(err, ErrBlackout) {
+				// try the step again until the blackout is off
+				run = time.After(time.Second)
+				continue
+			}
+			if err != nil && ctx.Err() == nil {
+				c.errs <- fmt.Errorf("chase %s step %d: %w", s, step, err)
 			}
 
 			step++
@@ -557,6 +1122,12 @@ type Section struct {
 type Call struct {
 	Cue   string
 	Chase string
+
+	// Record is the slug of a cue to record the state of Targets into,
+	// titled Text.
+	Record  string
+	Text    string
+	Targets []string
 }
 
 const Banner = `
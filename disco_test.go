@@ -1 +1,1098 @@
 package disco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChaserStopAbortsStep(t *testing.T) {
+	started, aborted := make(chan struct{}), make(chan error, 1)
+	chases := map[string]Chase{
+		"slow": {Steps: [][]Cmd{{ParseCmdString("dim all 100"), ParseCmdString("wait 1h")}}},
+	}
+	c, _ := NewChaser(blockCmdr(started, aborted), chases)
+	c.Chase("slow")
+	<-started
+	c.Stop("slow")
+	select {
+	case err := <-aborted:
+		if err != context.Canceled {
+			t.Errorf("expected %s got %s", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("step was not aborted")
+	}
+}
+
+func TestCmdrsConcurrentAttribution(t *testing.T) {
+	var (
+		wg      = make(chan struct{}, 2)
+		barrier = func() {
+			wg <- struct{}{}
+			for len(wg) < 2 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	)
+	hue := funcCmdr(func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+		barrier()
+		return nil, nil
+	})
+	lifx := funcCmdr(func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+		barrier()
+		return nil, TargetErr("cf5a26d573d0", errors.New("did not ack"))
+	})
+	cs := Cmdrs{WithPrefix(hue, "hue/"), WithTimeout(WithPrefix(lifx, "lifx/"), time.Second)}
+
+	done := make(chan error)
+	go func() {
+		_, err := cs.Cmd(context.Background(), []Cmd{ParseCmdString("switch lifx/cf5a26d573d0 on")})
+		done <- err
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(time.Second):
+		t.Fatal("backends did not run concurrently")
+	}
+
+	es := AsErrors(err)
+	if len(es) != 1 {
+		t.Fatalf("expected 1 error got %d: %v", len(es), err)
+	}
+	if es[0].Backend != "lifx" || es[0].Target != "lifx/cf5a26d573d0" {
+		t.Errorf("expected lifx lifx/cf5a26d573d0 got %s %s", es[0].Backend, es[0].Target)
+	}
+	if s := es[0].Error(); s != "lifx/cf5a26d573d0: did not ack" {
+		t.Errorf("unexpected message %q", s)
+	}
+}
+
+func TestResults(t *testing.T) {
+	lifx := funcCmdr(func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+		return nil, errors.Join(
+			TargetErr("2eff97d573d0", fmt.Errorf("%w: did not ack", ErrUnreachable)),
+			TargetErr("c4633dd573d0", errors.New("dimming values range from 0 to 100")),
+			TargetErr("4ee90ed573d0", context.DeadlineExceeded),
+		)
+	})
+	m := map[string]string{
+		"lifx/51a021d573d0": "down01",
+		"lifx/2eff97d573d0": "down08",
+		"lifx/c4633dd573d0": "down09",
+		"lifx/4ee90ed573d0": "down10",
+	}
+	c := WithLink(WithMap(Cmdrs{WithPrefix(lifx, "lifx/")}, m), map[string][]string{
+		"downs": {"down01", "down08", "down09", "down10"},
+	})
+
+	ctx, rs := WithResults(context.Background())
+	c.Cmd(ctx, []Cmd{ParseCmdString("dim downs 50")})
+
+	ex := map[string]Status{
+		"down01": Applied,
+		"down08": Unreachable,
+		"down09": Invalid,
+		"down10": TimedOut,
+	}
+	got := rs.List()
+	if len(got) != len(ex) {
+		t.Fatalf("expected %d results got %d", len(ex), len(got))
+	}
+	for _, r := range got {
+		if s, ok := ex[r.Cmd.Target]; !ok || s != r.Status {
+			t.Errorf("%s: expected %s got %s", r.Cmd.Target, s, r.Status)
+		}
+		if m[r.Device] != r.Cmd.Target {
+			t.Errorf("%s: unexpected device %s", r.Cmd.Target, r.Device)
+		}
+	}
+}
+
+func TestResultsNotSent(t *testing.T) {
+	state := map[string]Cmd{"switcha": ParseCmdString("switch a on"), "dima": ParseCmdString("dim a 40")}
+	blackout := WithBlackout(stateCmdr(state))
+	park := WithPark(stateCmdr(state))
+	for _, c := range []Cmdr{blackout, park} {
+		if _, err := c.Cmd(context.Background(), []Cmd{ParseCmdString("blackout"), ParseCmdString("park a")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var zs = []struct {
+		c   Cmdr
+		cmd string
+		ex  Status
+	}{
+		{Cmdrs{WithPrefix(stateCmdr(state), "faux/")}, "dim hue/1 50", Skipped},
+		{blackout, "dim a 50", Held},
+		{park, "dim a 50", Skipped},
+		{WithRelative(stateCmdr(state)), "dim c +10", Unreachable},
+		{WithToggle(stateCmdr(state), ToggleAny), "toggle a most", Invalid},
+		{WithToggle(stateCmdr(state), ToggleAny), "toggle c", Unreachable},
+	}
+	for _, z := range zs {
+		ctx, rs := WithResults(context.Background())
+		z.c.Cmd(ctx, []Cmd{ParseCmdString(z.cmd)})
+		got := rs.List()
+		if len(got) != 1 || got[0].Status != z.ex || got[0].Err == nil {
+			t.Errorf("%s: expected one %s result got %v", z.cmd, z.ex, got)
+			continue
+		}
+		if got[0].Cmd.String() != z.cmd {
+			t.Errorf("%s: unexpected command %s", z.cmd, got[0].Cmd)
+		}
+	}
+}
+
+func TestLinkerCycle(t *testing.T) {
+	var got []Cmd
+	l := WithLink(recordCmdr(&got), map[string][]string{
+		"a": {"b"},
+		"b": {"c", "a"},
+		"c": {"c1"},
+	})
+	_, err := l.Cmd(context.Background(), []Cmd{ParseCmdString("switch a on")})
+	if err == nil || err.Error() != "link cycle: a -> b -> a" {
+		t.Errorf("expected link cycle error got %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no commands got %v", got)
+	}
+}
+
+func TestLinkerDedupe(t *testing.T) {
+	var got []Cmd
+	l := WithLink(recordCmdr(&got), map[string][]string{
+		"decks":   {"decks1", "decks2", "decksb"},
+		"decks-o": {"decks1", "decks2"},
+		"all":     {"decks", "decks-o", "fire"},
+	})
+	_, err := l.Cmd(context.Background(), []Cmd{
+		ParseCmdString("color all ff0000"),
+		ParseCmdString("color decks-o 0000ff"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := []string{
+		"color decksb ff0000",
+		"color fire ff0000",
+		"color decks1 0000ff",
+		"color decks2 0000ff",
+	}
+	if len(got) != len(ex) {
+		t.Fatalf("expected %v got %v", ex, got)
+	}
+	for i := range ex {
+		if got[i].String() != ex[i] {
+			t.Errorf("%d: expected %s got %s", i, ex[i], got[i])
+		}
+	}
+}
+
+func TestCuerCycle(t *testing.T) {
+	var got []Cmd
+	c := WithCue(recordCmdr(&got), map[string]Cue{
+		"party":  {Cmds: []Cmd{ParseCmdString("cue lights"), ParseCmdString("cue party")}},
+		"lights": {Cmds: []Cmd{ParseCmdString("switch all on")}},
+	})
+	_, err := c.Cmd(context.Background(), []Cmd{ParseCmdString("cue party")})
+	if err == nil || err.Error() != "cue cycle: party -> party" {
+		t.Errorf("expected cue cycle error got %v", err)
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	c := Config{
+		Map:  map[string]string{"hue/1": "a", "hue/2": "b"},
+		Link: map[string][]string{"ab": {"a", "b"}, "x": {"y"}, "y": {"x"}, "bad": {"c"}},
+		Cue: map[string]Cue{
+			"ok":  {Cmds: []Cmd{ParseCmdString("switch ab on"), ParseCmdString("dim a 50 2s")}},
+			"bad": {Cmds: []Cmd{ParseCmdString("dim a 150"), ParseCmdString("color b terracota"), ParseCmdString("cue nope")}},
+		},
+		Chase: map[string]Chase{
+			"loop": {Steps: [][]Cmd{{ParseCmdString("switch a on"), ParseCmdString("wait 1x")}}},
+		},
+		Sheet: []Page{{Text: "main", Sections: []Section{{Group: [][]Call{{{Cue: "ok"}, {Chase: "gone"}}}}}}},
+	}
+	ex := []string{
+		"link bad: c is not a link or mapped name",
+		"link x: link cycle: x -> y -> x",
+		"link y: link cycle: y -> x -> y",
+		"cue bad: dim a 150: dimming values range from 0 to 100",
+		"cue bad: color b terracota: terracota is not a color",
+		`cue bad: cue not found: "nope"`,
+		`chase loop step 0: wait 1x: time: unknown unit "x" in duration "1x"`,
+		"sheet main: chase gone not found",
+	}
+	err := c.Check()
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	got := strings.Split(err.Error(), "\n")
+	if !slices.Equal(got, ex) {
+		t.Errorf("expected\n  %s\ngot\n  %s", strings.Join(ex, "\n  "), strings.Join(got, "\n  "))
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var got []Cmd
+	c := New(Cmdrs{WithPrefix(recordCmdr(&got), "hue/")}, Config{
+		Map:  map[string]string{"hue/1": "a", "hue/2": "b"},
+		Link: map[string][]string{"ab": {"a", "b", "x"}},
+		Cue:  map[string]Cue{"q": {Cmds: []Cmd{ParseCmdString("dim a 10"), ParseCmdString("dim ab 50")}}},
+	})
+	ctx, tr := WithTrace(context.Background())
+	_, err := c.Cmd(ctx, []Cmd{ParseCmdString("cue q")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var steps []string
+	for _, s := range tr.List() {
+		steps = append(steps, fmt.Sprintf("%s %s: %s", s.Stage, s.In, s.Note))
+	}
+	ex := []string{
+		"cue cue q: cue q",
+		"link dim ab 50: link ab",
+		"link dim a 10: dropped, overridden by a later command",
+		"map dim a 50: map hue/1: a",
+		"map dim b 50: map hue/2: b",
+		"backend dim x 50: dropped, no backend",
+		"backend dim hue/1 50: hue",
+		"backend dim hue/2 50: hue",
+	}
+	if !slices.Equal(steps, ex) {
+		t.Errorf("expected\n  %s\ngot\n  %s", strings.Join(ex, "\n  "), strings.Join(steps, "\n  "))
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	var (
+		state = map[string]Cmd{}
+		got   []Cmd
+	)
+	c := WithSnapshot(funcCmdr(func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+		var cout []Cmd
+		for _, cmd := range cmds {
+			if len(cmd.Args) > 0 {
+				got = append(got, cmd)
+				state[cmd.Action+cmd.Target] = Cmd{cmd.Action, cmd.Target, cmd.Args[:1]}
+				continue
+			}
+			for _, target := range []string{"a", "b"} {
+				if s, ok := state[cmd.Action+target]; ok && (cmd.Target == "" || cmd.Target == target) {
+					cout = append(cout, s)
+				}
+			}
+		}
+		return cout, nil
+	}), filepath.Join(t.TempDir(), "snapshots.json"))
+
+	ctx := context.Background()
+	_, err := c.Cmd(ctx, []Cmd{
+		ParseCmdString("dim a 50"),
+		ParseCmdString("dim b 70"),
+		ParseCmdString("snapshot party"),
+		ParseCmdString("dim a 10"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	_, err = c.Cmd(ctx, []Cmd{ParseCmdString("restore party 2s")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := []Cmd{ParseCmdString("dim a 50 2s"), ParseCmdString("dim b 70 2s")}
+	if !slices.EqualFunc(got, ex, func(a, b Cmd) bool { return a.String() == b.String() }) {
+		t.Errorf("expected %v got %v", ex, got)
+	}
+
+	c = WithSnapshot(c.Cmdr, c.File)
+	_, err = c.Cmd(ctx, []Cmd{ParseCmdString("restore party")})
+	if err != nil {
+		t.Errorf("expected snapshot to persist got %v", err)
+	}
+	_, err = c.Cmd(ctx, []Cmd{ParseCmdString("restore nope")})
+	if err == nil {
+		t.Error("expected snapshot not found")
+	}
+
+	// a dry run leaves the snapshot as it was
+	c = WithSnapshot(c.Cmdr, "")
+	for _, cs := range [][]Cmd{
+		{ParseCmdString("snapshot party")},
+		{ParseCmdString("dim a 30")},
+	} {
+		if _, err := c.Cmd(ctx, cs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Cmd(WithDryRun(ctx), []Cmd{ParseCmdString("snapshot party")}); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	if _, err := c.Cmd(ctx, []Cmd{ParseCmdString("restore party")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].String() != "dim a 50" {
+		t.Errorf("expected the snapshot from before the dry run got %v", got)
+	}
+}
+
+func TestLinkerCompress(t *testing.T) {
+	l := WithLink(nil, map[string][]string{
+		"ab":  {"a", "b"},
+		"abc": {"ab", "c"},
+		"cd":  {"c", "d"},
+	})
+	var cmds []Cmd
+	for _, s := range []string{
+		"dim a 50", "dim b 50", "dim c 50", "dim d 20",
+		"color d ff0000", "color c ff0000", "color a 00ff00",
+	} {
+		cmds = append(cmds, ParseCmdString(s))
+	}
+	var got []string
+	for _, cmd := range l.Compress(cmds) {
+		got = append(got, cmd.String())
+	}
+	ex := []string{"dim abc 50", "dim d 20", "color cd ff0000", "color a 00ff00"}
+	if !slices.Equal(got, ex) {
+		t.Errorf("expected %q got %q", ex, got)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		state = map[string]Cmd{}
+		h     = WithHistory(stateCmdr(state), 2)
+		dims  = func() string {
+			return state["dima"].String() + ", " + state["dimb"].String()
+		}
+	)
+	for _, s := range []string{"dim a 10", "dim b 20", "dim a 30", "dim b 40"} {
+		if _, err := h.Cmd(ctx, []Cmd{ParseCmdString(s)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var zs = []struct {
+		cmd string
+		ex  string
+	}{
+		{"undo", "dim a 30, dim b 20"},
+		{"undo 5 1s", "dim a 10, dim b 20"},
+		{"redo", "dim a 30, dim b 20"},
+		{"redo", "dim a 30, dim b 40"},
+	}
+	for _, z := range zs {
+		if _, err := h.Cmd(ctx, []Cmd{ParseCmdString(z.cmd)}); err != nil {
+			t.Fatalf("%s: %s", z.cmd, err)
+		}
+		if got := dims(); got != z.ex {
+			t.Errorf("%s: expected %s got %s", z.cmd, z.ex, got)
+		}
+	}
+	if _, err := h.Cmd(ctx, []Cmd{ParseCmdString("redo")}); err == nil {
+		t.Error("expected nothing to redo")
+	}
+}
+
+func TestHistoryFailed(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		state = map[string]Cmd{"dima": ParseCmdString("dim a 10"), "dimb": ParseCmdString("dim b 20")}
+		sc    = stateCmdr(state)
+		// sets on b fail
+		h = WithHistory(funcCmdr(func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+			var errs error
+			cmds = slices.DeleteFunc(cmds, func(c Cmd) bool {
+				if c.Target == "b" && len(c.Args) > 0 {
+					errs = errors.Join(errs, TargetErr("b", ErrUnreachable))
+					return true
+				}
+				return false
+			})
+			cs, err := sc(ctx, cmds)
+			return cs, errors.Join(errs, err)
+		}), 5)
+	)
+	h.Cmd(ctx, []Cmd{ParseCmdString("dim a 30"), ParseCmdString("dim b 40")})
+	h.Cmd(ctx, []Cmd{ParseCmdString("dim b 50")})
+	if len(h.st.undo) != 1 {
+		t.Fatalf("expected one change got %d", len(h.st.undo))
+	}
+	if got := h.st.undo[0].before; len(got) != 1 || got[0].String() != "dim a 10" {
+		t.Errorf("expected only dim a 10 before got %v", got)
+	}
+}
+
+func TestCache(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		state = map[string]Cmd{"dima": ParseCmdString("dim a 10")}
+		calls int
+		w     = watchCmdr{funcCmdr(func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+			calls++
+			return stateCmdr(state)(ctx, cmds)
+		}), make(chan Cmd)}
+		c   = WithCache(w, time.Minute)
+		get = func(s string) string {
+			cs, err := c.Cmd(ctx, []Cmd{ParseCmdString(s)})
+			if err != nil || len(cs) != 1 {
+				t.Fatalf("%s: unexpected %v %v", s, cs, err)
+			}
+			return cs[0].String()
+		}
+	)
+	defer c.Close()
+	if got := get("dim a"); got != "dim a 10" {
+		t.Errorf("expected dim a 10 got %s", got)
+	}
+	w.c <- ParseCmdString("dim a 20")
+	w.c <- ParseCmdString("switch a on")
+	// the changes are in the model once the next is taken
+	w.c <- Cmd{}
+	if got := get("dim a"); got != "dim a 20" {
+		t.Errorf("expected dim a 20 from watch got %s", got)
+	}
+	if _, err := c.Cmd(ctx, []Cmd{ParseCmdString("dim a 30 2s")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("dim a"); got != "dim a 30" {
+		t.Errorf("expected dim a 30 from set got %s", got)
+	}
+	if _, err := c.Cmd(ctx, []Cmd{ParseCmdString("switch a off 3s")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("switch a"); got != "switch a on" {
+		t.Errorf("expected switch a on until the watch says otherwise got %s", got)
+	}
+	w.c <- ParseCmdString("switch a off")
+	w.c <- Cmd{}
+	if got := get("switch a"); got != "switch a off" {
+		t.Errorf("expected switch a off from watch got %s", got)
+	}
+	if calls != 3 {
+		t.Errorf("expected one refresh and two sets got %d calls", calls)
+	}
+
+	close(w.c)
+	w.c = make(chan Cmd)
+	c.Cmdr = w
+	state["dima"] = ParseCmdString("dim a 40")
+	time.Sleep(10 * time.Millisecond)
+	if got := get("dim a"); got != "dim a 40" {
+		t.Errorf("expected refresh after watch dropped got %s", got)
+	}
+}
+
+func TestCacheDisconnect(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		mu    = &sync.Mutex{}
+		state = map[string]Cmd{"dima": ParseCmdString("dim a 10")}
+		calls int
+		w     = watchCmdr{funcCmdr(func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			return stateCmdr(state)(ctx, cmds)
+		}), make(chan Cmd)}
+		m = Multi(w)
+		c = WithCache(m, time.Minute)
+	)
+	m.Buffer = 1
+	if _, err := c.Cmd(ctx, []Cmd{ParseCmdString("dim a")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a cache too slow for the changes is disconnected rather than miss any
+	c.mu.Lock()
+	for i := range 5 {
+		w.c <- DimCmd("a", float64(20+i))
+	}
+	for i := 0; len(m.Stats()) > 0; i++ {
+		if i > 1000 {
+			t.Fatal("expected the cache disconnected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	state["dima"] = ParseCmdString("dim a 50")
+	mu.Unlock()
+	c.mu.Unlock()
+
+	for i := 0; ; i++ {
+		mu.Lock()
+		n := calls
+		mu.Unlock()
+		if n > 1 {
+			break
+		}
+		if i > 300 {
+			t.Fatal("expected the state read again after the watch dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.mu.Lock()
+	got := c.st.model[[2]string{"dim", "a"}].String()
+	c.mu.Unlock()
+	if got != "dim a 50" {
+		t.Errorf("expected dim a 50 got %s", got)
+	}
+
+	c.Close()
+	for i := 0; len(m.Stats()) > 0; i++ {
+		if i > 1000 {
+			t.Fatal("expected the watch stopped on close")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		reading     = make(chan struct{})
+		w           = watchCmdr{c: make(chan Cmd)}
+	)
+	defer cancel()
+	w.Cmdr = funcCmdr(func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+		if cmds[0].Action != "switch" {
+			return nil, nil
+		}
+		// changes while the state is read, older than it and newer
+		close(reading)
+		w.c <- ParseCmdString("dim a 50")
+		w.c <- ParseCmdString("dim a 60")
+		w.c <- ParseCmdString("switch b off")
+		w.c <- ParseCmdString("status b reachable")
+		// let the last change be queued
+		time.Sleep(10 * time.Millisecond)
+		return []Cmd{
+			ParseCmdString("switch a on"),
+			ParseCmdString("switch b on"),
+			ParseCmdString("dim a 60"),
+			ParseCmdString("status a reachable"),
+			ParseCmdString("status b unreachable"),
+		}, nil
+	})
+	go func() {
+		<-reading
+		// wait for the state to be read before the next change
+		time.Sleep(50 * time.Millisecond)
+		w.c <- ParseCmdString("switch a off")
+		close(w.c)
+	}()
+
+	c, err := Replay(ctx, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		n     int
+		final = map[string]string{}
+	)
+	for cmd := range c {
+		n++
+		final[cmd.Action+" "+cmd.Target] = cmd.String()
+	}
+	ex := map[string]string{
+		"switch a": "switch a off",
+		"switch b": "switch b off",
+		"dim a":    "dim a 60",
+		"status a": "status a reachable",
+		"status b": "status b reachable",
+	}
+	if !maps.Equal(final, ex) {
+		t.Errorf("expected %q got %q", ex, final)
+	}
+	if n != 6 {
+		t.Errorf("expected the state of 5 targets and 1 change, got %d commands", n)
+	}
+}
+
+func TestMultiWatcher(t *testing.T) {
+	recv := func(c <-chan Cmd) (Cmd, bool) {
+		select {
+		case cmd, ok := <-c:
+			return cmd, ok
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+		return Cmd{}, false
+	}
+	cmds := []string{"dim a 1", "dim b 1", "dim a 2", "dim c 1"}
+
+	t.Run("coalesce", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		w := watchCmdr{c: make(chan Cmd)}
+		m := Multi(w)
+		m.Buffer, m.Policy = 3, Coalesce
+		slow, _ := m.Watch(ctx)
+		fast, _ := m.Watch(ctx)
+		go func() {
+			for _, s := range cmds {
+				w.c <- ParseCmdString(s)
+			}
+		}()
+		// both see the latest value of every target, the fast one is not
+		// held up by the slow one
+		for _, c := range []<-chan Cmd{fast, slow} {
+			got := map[string]string{}
+			for len(got) < 3 || got["a"] != "2" {
+				cmd, _ := recv(c)
+				got[cmd.Target] = cmd.Args[0]
+			}
+			if got["b"] != "1" || got["c"] != "1" {
+				t.Fatalf("unexpected %v", got)
+			}
+		}
+		if ss := m.Stats(); len(ss) != 2 || ss[0].Id != 1 || ss[0].MaxLag > 3 {
+			t.Fatalf("unexpected stats %+v", ss)
+		}
+	})
+
+	t.Run("policy", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		w := watchCmdr{c: make(chan Cmd)}
+		m := Multi(w)
+		m.Buffer = 1
+		slow, _ := m.Watch(ctx)
+		gone, _ := m.Watch(WithPolicy(ctx, Disconnect))
+		fast, _ := m.Watch(ctx)
+		go func() {
+			for _, s := range cmds {
+				w.c <- ParseCmdString(s)
+			}
+		}()
+		for len(m.Stats()) > 2 {
+			time.Sleep(time.Millisecond)
+		}
+		for {
+			if _, ok := recv(gone); !ok {
+				break
+			}
+		}
+		// the rest keep the policy of the MultiWatcher
+		for _, c := range []<-chan Cmd{fast, slow} {
+			var last Cmd
+			for last.Target != "c" {
+				last, _ = recv(c)
+			}
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		w := watchCmdr{c: make(chan Cmd)}
+		m := Multi(w)
+		m.Buffer, m.Policy = 1, Disconnect
+		slow, _ := m.Watch(ctx)
+		fast, _ := m.Watch(ctx)
+		go func() {
+			for _, s := range cmds {
+				w.c <- ParseCmdString(s)
+			}
+		}()
+		for range cmds {
+			recv(fast)
+		}
+		for len(m.Stats()) > 1 {
+			time.Sleep(time.Millisecond)
+		}
+		for {
+			if _, ok := recv(slow); !ok {
+				break
+			}
+		}
+	})
+}
+
+func TestReconciler(t *testing.T) {
+	ctx := context.Background()
+	nop := funcCmdr(func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+		return nil, nil
+	})
+	observe := func(r Reconciler, s string) string {
+		clear(r.st.settle)
+		var ss []string
+		for _, cmd := range r.observe(ParseCmdString(s)) {
+			ss = append(ss, cmd.String())
+		}
+		return strings.Join(ss, ", ")
+	}
+	var zs = []struct {
+		manual Manual
+		set    string
+		steps  [][2]string
+	}{
+		{ManualExclude, "switch a on", [][2]string{
+			{"status a reachable", "switch a on, dim a 50"},
+			{"switch a on", "switch a on, dim a 50"},
+			{"dim a 49", ""},
+			{"dim b 20", ""},
+			{"dim a 20", ""},
+			{"status a reachable", ""},
+		}},
+		{ManualRevert, "switch a off", [][2]string{
+			{"dim a 20", "dim a 50, switch a off"},
+			{"switch a on", "dim a 50, switch a off"},
+		}},
+		{ManualAdopt, "switch a on", [][2]string{
+			{"dim a 20", ""},
+			{"status a reachable", "switch a on, dim a 20"},
+		}},
+	}
+	for _, z := range zs {
+		r := WithReconcile(nop, z.manual)
+		r.Cmd(ctx, []Cmd{ParseCmdString(z.set), ParseCmdString("dim a 50 0s")})
+		for _, step := range z.steps {
+			if got := observe(r, step[0]); got != step[1] {
+				t.Errorf("%s: %s: expected %q got %q", z.manual, step[0], step[1], got)
+			}
+		}
+	}
+
+	// set again, the target is no longer excluded
+	r := WithReconcile(nop, ManualExclude)
+	r.Cmd(ctx, []Cmd{ParseCmdString("dim a 50 0s")})
+	observe(r, "dim a 20")
+	r.Cmd(ctx, []Cmd{ParseCmdString("dim a 60 0s")})
+	if got := observe(r, "status a reachable"); got != "dim a 60" {
+		t.Errorf("expected dim a 60 got %q", got)
+	}
+	// changes are ignored while the target settles
+	if cs := r.observe(ParseCmdString("dim a 20")); len(cs) > 0 {
+		t.Errorf("unexpected %v", cs)
+	}
+}
+
+func TestRelative(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		state = map[string]Cmd{}
+		c     = WithLink(WithRelative(stateCmdr(state)), map[string][]string{"ab": {"a", "b"}})
+	)
+	var zs = []struct {
+		cmd string
+		ex  string
+	}{
+		{"dim a 50", "dim a 50"},
+		{"dim b 95", "dim b 95"},
+		{"dim ab +10", "dim a 60, dim b 100"},
+		{"dim ab -20 2s", "dim a 40, dim b 80"},
+		{"dim ab *0.5", "dim a 20, dim b 40"},
+		{"color a ff0000", "color a ff0000"},
+		{"color a rotate 120", "color a 00ff00"},
+		{"color a shift 0000ff 50", "color a 00ffff"},
+		{"color a desaturate 50 1s", "color a 7fffff"},
+		{"color a saturate 100", "color a 00ffff"},
+	}
+	for _, z := range zs {
+		if _, err := c.Cmd(ctx, []Cmd{ParseCmdString(z.cmd)}); err != nil {
+			t.Fatalf("%s: %s", z.cmd, err)
+		}
+		cmd := ParseCmdString(z.ex)
+		var got []string
+		for _, target := range []string{"a", "b"} {
+			if s, ok := state[cmd.Action+target]; ok && strings.Contains(z.ex, " "+target+" ") {
+				got = append(got, s.String())
+			}
+		}
+		if g := strings.Join(got, ", "); g != z.ex {
+			t.Errorf("%s: expected %q got %q", z.cmd, z.ex, g)
+		}
+	}
+
+	// a gradient light answers the color getter for each of its points
+	var set []string
+	g := WithRelative(funcCmdr(func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+		if len(cmds[0].Args) > 0 {
+			for _, cmd := range cmds {
+				set = append(set, cmd.String())
+			}
+			return nil, nil
+		}
+		return []Cmd{ParseCmdString("color g/0 ff0000"), ParseCmdString("color g/1 00ff00")}, nil
+	}))
+	if _, err := g.Cmd(ctx, []Cmd{ParseCmdString("color g rotate 120")}); err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.Join(set, ", "); s != "color g/0 00ff00, color g/1 0000ff" {
+		t.Errorf("expected each point rotated got %q", s)
+	}
+
+	if _, err := c.Cmd(ctx, []Cmd{ParseCmdString("dim c +10")}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if err := CheckCmd(ParseCmdString("color a shift 0000ff 50 2s")); err != nil {
+		t.Error(err)
+	}
+	for _, s := range []string{"dim a +x", "color a rotate", "color a shift nope 10", "color a saturate 150", "color a shift 0000ff 50 2s 3s"} {
+		if err := CheckCmd(ParseCmdString(s)); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestToggle(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		state = map[string]Cmd{}
+		l     = WithLink(stateCmdr(state), map[string][]string{"ab": {"a", "b"}})
+	)
+	var zs = []struct {
+		rule, a, b string
+		cmd        string
+		ex         string
+	}{
+		{"", "on", "off", "toggle ab", "off off"},
+		{"", "off", "off", "toggle ab", "on on"},
+		{ToggleMajority, "on", "off", "toggle ab", "on on"},
+		{ToggleMajority, "on", "on", "toggle ab", "off off"},
+		{ToggleMajority, "on", "off", "toggle ab any", "off off"},
+		{"", "on", "off", "toggle b", "on on"},
+	}
+	for _, z := range zs {
+		state["switcha"] = ParseCmdString("switch a " + z.a)
+		state["switchb"] = ParseCmdString("switch b " + z.b)
+		if _, err := WithToggle(l, z.rule).Cmd(ctx, []Cmd{ParseCmdString(z.cmd)}); err != nil {
+			t.Fatal(err)
+		}
+		if got := state["switcha"].Args[0] + " " + state["switchb"].Args[0]; got != z.ex {
+			t.Errorf("%s %s %s %s: expected %s got %s", z.rule, z.a, z.b, z.cmd, z.ex, got)
+		}
+	}
+	if err := CheckCmd(ParseCmdString("toggle ab most")); err == nil {
+		t.Error("expected error for unknown rule")
+	}
+}
+
+func TestSwitchFade(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		state = map[string]Cmd{}
+		calls []string
+		f     = WithSwitchFade(funcCmdr(func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+			if len(cmds[0].Args) > 0 {
+				var ss []string
+				for _, cmd := range cmds {
+					ss = append(ss, cmd.String())
+				}
+				calls = append(calls, strings.Join(ss, ", "))
+			}
+			return stateCmdr(state)(ctx, cmds)
+		}))
+		run = func(s string) {
+			calls = nil
+			if _, err := f.Cmd(ctx, []Cmd{ParseCmdString(s)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expect = func(ex ...string) {
+			t.Helper()
+			if !slices.Equal(calls, ex) {
+				t.Errorf("expected %q got %q", ex, calls)
+			}
+		}
+	)
+	state["switcha"] = ParseCmdString("switch a on")
+	state["dima"] = ParseCmdString("dim a 60")
+
+	run("switch a off 10ms")
+	f.Wait()
+	expect("dim a 0 10ms", "switch a off, dim a 60 0s")
+
+	run("switch a on 1s")
+	expect("dim a 0 0s", "switch a on, dim a 60 1s")
+
+	// set again before the fade is done
+	run("switch a off 1h")
+	run("switch a on")
+	f.Wait()
+	expect("dim a 60 0s", "switch a on")
+
+	// nothing to fade
+	run("switch a on 1s")
+	expect("switch a on")
+}
+
+func TestMaster(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		state = map[string]Cmd{}
+		links = map[string][]string{"ab": {"a", "b"}, "bb": {"b"}}
+		grand = WithMaster(stateCmdr(state), links)
+		m     = WithMasters(WithLink(grand, links), grand)
+		dims  = func() string {
+			return state["dima"].Args[0] + " " + state["dimb"].Args[0]
+		}
+	)
+	var zs = []struct {
+		cmd string
+		ex  string
+	}{
+		{"dim ab 80", "80 80"},
+		{"master 50", "40 40"},
+		{"sub bb 50", "40 20"},
+		{"dim a 60", "30 20"},
+		{"master 100", "60 40"},
+		{"sub bb 100 1s", "60 80"},
+	}
+	for _, z := range zs {
+		if _, err := m.Cmd(ctx, []Cmd{ParseCmdString(z.cmd)}); err != nil {
+			t.Fatal(err)
+		}
+		if got := dims(); got != z.ex {
+			t.Errorf("%s: expected %s got %s", z.cmd, z.ex, got)
+		}
+	}
+
+	m.Cmd(ctx, []Cmd{ParseCmdString("master 25")})
+	for cmd, ex := range map[string]string{
+		"dim a":  "dim a 60",
+		"master": "master 25",
+		"sub bb": "sub bb 100",
+		"sub ab": "sub ab 100",
+	} {
+		cs, err := m.Cmd(ctx, []Cmd{ParseCmdString(cmd)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cs) != 1 || cs[0].String() != ex {
+			t.Errorf("%s: expected %s got %v", cmd, ex, cs)
+		}
+	}
+
+	// changed by something else, so the level last set is stale
+	state["dima"] = ParseCmdString("dim a 10")
+	cs, err := m.Cmd(ctx, []Cmd{ParseCmdString("dim a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) != 1 || cs[0].String() != "dim a 40" {
+		t.Errorf("expected dim a 40 got %v", cs)
+	}
+	if err := CheckCmd(ParseCmdString("master 150")); err == nil {
+		t.Error("expected error for master out of range")
+	}
+}
+
+func TestBlackout(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		state = map[string]Cmd{
+			"switcha": ParseCmdString("switch a on"),
+			"switchb": ParseCmdString("switch b off"),
+			"dima":    ParseCmdString("dim a 50"),
+			"dimb":    ParseCmdString("dim b 20"),
+		}
+		b    = WithBlackout(stateCmdr(state))
+		lamp = func() string {
+			var ss []string
+			for _, k := range []string{"switcha", "switchb", "dima", "dimb"} {
+				ss = append(ss, state[k].Args[0])
+			}
+			return strings.Join(ss, " ")
+		}
+		run = func(ctx context.Context, s string) ([]Cmd, error) {
+			return b.Cmd(ctx, []Cmd{ParseCmdString(s)})
+		}
+	)
+	var zs = []struct {
+		cmd string
+		ex  string
+	}{
+		{"blackout 1s", "off off 50 20"},
+		{"dim a 80", "off off 50 20"},
+		{"switch b on", "off off 50 20"},
+		{"blackout off", "on on 80 20"},
+		{"dim a 10", "on on 10 20"},
+	}
+	for _, z := range zs {
+		if _, err := run(ctx, z.cmd); err != nil {
+			t.Fatal(err)
+		}
+		if got := lamp(); got != z.ex {
+			t.Errorf("%s: expected %s got %s", z.cmd, z.ex, got)
+		}
+	}
+
+	run(ctx, "blackout")
+	run(ctx, "dim b 30")
+	cs, err := run(ctx, "dim b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) != 1 || cs[0].String() != "dim b 30" {
+		t.Errorf("expected the held dim b 30 got %v", cs)
+	}
+	chase := context.WithValue(ctx, chaseKey{}, true)
+	if _, err := run(chase, "dim a 100"); !errors.Is(err, ErrBlackout) {
+		t.Errorf("expected ErrBlackout for a chase step got %v", err)
+	}
+	run(ctx, "blackout off")
+	if _, err := run(chase, "dim a 100"); err != nil {
+		t.Error(err)
+	}
+	if got := lamp(); got != "on on 100 30" {
+		t.Errorf("expected on on 100 30 got %s", got)
+	}
+}
+
+func TestPark(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		state = map[string]Cmd{}
+		p     = WithLink(WithPark(stateCmdr(state)), map[string][]string{"ab": {"a", "b"}})
+		dims  = func() string {
+			return state["dima"].Args[0] + " " + state["dimb"].Args[0]
+		}
+	)
+	var zs = []struct {
+		cmd string
+		ex  string
+	}{
+		{"dim ab 80", "80 80"},
+		{"park a dim 40", "40 80"},
+		{"dim ab 20", "40 20"},
+		{"dim a 60 2s", "40 20"},
+		{"unpark a", "60 20"},
+		{"dim ab 10", "10 10"},
+	}
+	for _, z := range zs {
+		if _, err := p.Cmd(ctx, []Cmd{ParseCmdString(z.cmd)}); err != nil {
+			t.Fatal(err)
+		}
+		if got := dims(); got != z.ex {
+			t.Errorf("%s: expected %s got %s", z.cmd, z.ex, got)
+		}
+	}
+
+	p.Cmd(ctx, []Cmd{ParseCmdString("park b color ff0000")})
+	cs, err := p.Cmd(ctx, []Cmd{{Action: "park"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) != 1 || cs[0].String() != "park b color ff0000" {
+		t.Errorf("expected park b color ff0000 got %v", cs)
+	}
+	if err := CheckCmd(ParseCmdString("park a dim")); err == nil {
+		t.Error("expected error for park without a value")
+	}
+}
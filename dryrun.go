@@ -0,0 +1,41 @@
+package disco
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+type dryRunKey struct{}
+
+// WithDryRun returns a context that tells backends to parse and check
+// commands as usual but not to send anything to the devices. Instead they
+// return a request command for each request they would have made.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun reports whether ctx is a dry run.
+func IsDryRun(ctx context.Context) bool {
+	v, _ := ctx.Value(dryRunKey{}).(bool)
+	return v
+}
+
+// RequestCmd describes a request a backend would make to target in a dry run.
+// The body is encoded as JSON.
+func RequestCmd(target string, body any) Cmd {
+	b, err := json.Marshal(body)
+	if err != nil {
+		b = []byte(fmt.Sprint(body))
+	}
+	return newCmd("request", target, string(b))
+}
+
+// DryRun passes every command to the Cmdr as a dry run.
+type DryRun struct {
+	Cmdr
+}
+
+func (d DryRun) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	return d.Cmdr.Cmd(WithDryRun(ctx), cmds)
+}
@@ -0,0 +1,63 @@
+package disco
+
+import "context"
+
+// funcCmdr is a Cmdr that calls itself, with no watch stream.
+type funcCmdr func(ctx context.Context, cmds []Cmd) ([]Cmd, error)
+
+func (f funcCmdr) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	return f(ctx, cmds)
+}
+
+func (f funcCmdr) Watch(ctx context.Context) (<-chan Cmd, error) {
+	return nil, nil
+}
+
+// stateCmdr keeps the state of targets a and b in state, keyed by action and
+// target, and answers getters from it.
+func stateCmdr(state map[string]Cmd) funcCmdr {
+	return func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+		var cout []Cmd
+		for _, cmd := range cmds {
+			if len(cmd.Args) > 0 {
+				state[cmd.Action+cmd.Target] = Cmd{cmd.Action, cmd.Target, cmd.Args[:1]}
+				continue
+			}
+			for _, target := range []string{"a", "b"} {
+				if s, ok := state[cmd.Action+target]; ok && (cmd.Target == "" || cmd.Target == target) {
+					cout = append(cout, s)
+				}
+			}
+		}
+		return cout, nil
+	}
+}
+
+// recordCmdr appends the commands it is called with to got.
+func recordCmdr(got *[]Cmd) funcCmdr {
+	return func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+		*got = append(*got, cmds...)
+		return nil, nil
+	}
+}
+
+// blockCmdr blocks until the context is done, sending to started when it is
+// called and the context's error to aborted when it returns.
+func blockCmdr(started chan<- struct{}, aborted chan<- error) funcCmdr {
+	return func(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		aborted <- ctx.Err()
+		return nil, ctx.Err()
+	}
+}
+
+// watchCmdr is a Cmdr with a watch stream.
+type watchCmdr struct {
+	Cmdr
+	c chan Cmd
+}
+
+func (w watchCmdr) Watch(ctx context.Context) (<-chan Cmd, error) {
+	return w.c, nil
+}
@@ -2,7 +2,6 @@ package fauxcmd
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/dedelala/disco"
 	"github.com/dedelala/disco/color"
@@ -13,14 +12,18 @@ type Cmdr struct {
 	*faux.Client
 }
 
-func (c Cmdr) Cmd(cmds []disco.Cmd) ([]disco.Cmd, error) {
+func (c Cmdr) Cmd(ctx context.Context, cmds []disco.Cmd) ([]disco.Cmd, error) {
 	var (
 		cout []disco.Cmd
 	)
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	d, err := c.Load()
 	if err != nil {
-		return nil, fmt.Errorf("faux: %w", err)
+		return nil, err
 	}
 
 	for _, cmd := range cmds {
@@ -44,16 +47,36 @@ func (c Cmdr) Cmd(cmds []disco.Cmd) ([]disco.Cmd, error) {
 			}
 			cout = append(cout, cs...)
 		}
+		if disco.IsDryRun(ctx) && cmd.Target != "" && len(cmd.Args) > 0 {
+			cout = append(cout, request(cmd, d))
+		}
 	}
 
+	if disco.IsDryRun(ctx) {
+		return cout, nil
+	}
 	err = c.Save(d)
 	if err != nil {
-		return cout, fmt.Errorf("faux: %w", err)
+		return cout, err
 	}
 
 	return cout, nil
 }
 
+// request describes the change cmd would save in a dry run.
+func request(cmd disco.Cmd, d *faux.Data) disco.Cmd {
+	var v any
+	switch cmd.Action {
+	case "switch":
+		v = d.Ss[cmd.Target]
+	case "dim":
+		v = d.Ds[cmd.Target]
+	case "color":
+		v = d.Cs[cmd.Target].String()
+	}
+	return disco.RequestCmd(cmd.Target, map[string]any{cmd.Action: v})
+}
+
 func cmdSwitch(cmd disco.Cmd, ss map[string]bool) ([]disco.Cmd, error) {
 	if cmd.Target == "" {
 		var cout []disco.Cmd
@@ -65,13 +88,13 @@ func cmdSwitch(cmd disco.Cmd, ss map[string]bool) ([]disco.Cmd, error) {
 	on, ok := ss[cmd.Target]
 	if len(cmd.Args) == 0 {
 		if !ok {
-			return nil, fmt.Errorf("faux: has no target %s", cmd.Target)
+			return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
 		}
 		return []disco.Cmd{disco.SwitchCmd(cmd.Target, on)}, nil
 	}
 	on, err := disco.ParseSwitch(cmd.Args[0])
 	if err != nil {
-		return nil, fmt.Errorf("faux: %s: %w", cmd.Target, err)
+		return nil, disco.TargetErr(cmd.Target, err)
 	}
 	ss[cmd.Target] = on
 	return nil, nil
@@ -88,13 +111,13 @@ func cmdDim(cmd disco.Cmd, ds map[string]float64) ([]disco.Cmd, error) {
 	v, ok := ds[cmd.Target]
 	if len(cmd.Args) == 0 {
 		if !ok {
-			return nil, fmt.Errorf("faux: has no target %s", cmd.Target)
+			return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
 		}
 		return []disco.Cmd{disco.DimCmd(cmd.Target, v)}, nil
 	}
 	v, err := disco.ParseDim(cmd.Args[0])
 	if err != nil {
-		return nil, fmt.Errorf("faux: %s: %w", cmd.Target, err)
+		return nil, disco.TargetErr(cmd.Target, err)
 	}
 	ds[cmd.Target] = v
 	return nil, nil
@@ -111,13 +134,13 @@ func cmdColor(cmd disco.Cmd, cs map[string]color.Color) ([]disco.Cmd, error) {
 	c, ok := cs[cmd.Target]
 	if len(cmd.Args) == 0 {
 		if !ok {
-			return nil, fmt.Errorf("faux: has no target %s", cmd.Target)
+			return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
 		}
 		return []disco.Cmd{disco.ColorCmd(cmd.Target, c)}, nil
 	}
 	c, err := color.Parse(cmd.Args[0])
 	if err != nil {
-		return nil, fmt.Errorf("faux: %s: %w", cmd.Target, err)
+		return nil, disco.TargetErr(cmd.Target, err)
 	}
 
 	h, s, _ := c.HSVf()
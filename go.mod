@@ -4,11 +4,17 @@ go 1.22
 
 require (
 	github.com/ghodss/yaml v1.0.0
+	github.com/pion/dtls/v2 v2.2.12
 	golang.org/x/term v0.20.0
 	gonum.org/v1/gonum v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/pion/logging v0.2.2 // indirect
+	github.com/pion/transport/v2 v2.2.4 // indirect
+	golang.org/x/crypto v0.18.0 // indirect
+	golang.org/x/net v0.20.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
 	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
@@ -0,0 +1,194 @@
+package disco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// DefaultHistory is the number of calls History keeps if the size is not
+// configured.
+const DefaultHistory = 20
+
+// History records the state of every target before each call that sets
+// state, up to Size calls back. Chase steps and targets that failed are not
+// recorded. The undo action reverts the last n calls and redo applies them
+// again.
+//
+//	undo [n] [duration]
+//	redo [n]
+type History struct {
+	Cmdr
+	Size int
+
+	mu *sync.Mutex
+	st *stacks
+}
+
+type stacks struct {
+	undo, redo []change
+}
+
+// change is the commands of one call and the state before them.
+type change struct {
+	before []Cmd
+	cmds   []Cmd
+}
+
+func WithHistory(c Cmdr, size int) History {
+	return History{
+		Cmdr: c,
+		Size: size,
+		mu:   &sync.Mutex{},
+		st:   &stacks{},
+	}
+}
+
+func (h History) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var (
+		cout    []Cmd
+		errs    error
+		pending []Cmd
+	)
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		cs, err := h.apply(ctx, pending)
+		cout = append(cout, cs...)
+		errs = errors.Join(errs, err)
+		pending = nil
+	}
+	for _, cmd := range cmds {
+		switch cmd.Action {
+		case "undo", "redo":
+			flush()
+			cs, err := h.revert(ctx, cmd)
+			cout = append(cout, cs...)
+			errs = errors.Join(errs, err)
+		default:
+			pending = append(pending, cmd)
+		}
+	}
+	flush()
+	return cout, errs
+}
+
+// quiet returns ctx without results or trace, for reads the caller did not
+// ask for.
+func quiet(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, resultsKey{}, nil)
+	return context.WithValue(ctx, traceKey{}, nil)
+}
+
+type noHistoryKey struct{}
+
+// withoutHistory reports whether calls in ctx are left out of the history,
+// as chase steps are.
+func withoutHistory(ctx context.Context) bool {
+	v, _ := ctx.Value(noHistoryKey{}).(bool)
+	return v
+}
+
+// getter returns the getter for the state cmd sets, if it sets any.
+func getter(cmd Cmd) (Cmd, bool) {
+	if len(cmd.Args) == 0 || cmd.Target == "" {
+		return Cmd{}, false
+	}
+	switch cmd.Action {
+	case "switch", "dim", "color", "gradient":
+		return Cmd{Action: cmd.Action, Target: cmd.Target}, true
+	case "splay", "shuffle":
+		return Cmd{Action: "color", Target: cmd.Target}, true
+	}
+	return Cmd{}, false
+}
+
+func (h History) apply(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var gets []Cmd
+	for _, cmd := range cmds {
+		if g, ok := getter(cmd); ok {
+			gets = append(gets, g)
+		}
+	}
+	if len(gets) == 0 || h.Size <= 0 || IsDryRun(ctx) || withoutHistory(ctx) {
+		return h.Cmdr.Cmd(ctx, cmds)
+	}
+
+	before, _ := h.Cmdr.Cmd(quiet(ctx), dedupe(context.Background(), gets))
+	rctx, rs := collect(ctx)
+	cout, err := h.Cmdr.Cmd(rctx, cmds)
+
+	// a target held by a blackout still changes, when the blackout is off
+	failed := map[string]bool{}
+	for _, r := range rs.List() {
+		if r.Status != Applied && r.Status != Held {
+			failed[r.Cmd.Target] = true
+		}
+	}
+	errTarget := failedTargets(err)
+	before = slices.DeleteFunc(before, func(c Cmd) bool {
+		return failed[c.Target] || errTarget(c.Target)
+	})
+	if len(before) == 0 {
+		return cout, err
+	}
+
+	h.mu.Lock()
+	h.st.undo = append(h.st.undo, change{before, slices.Clone(cmds)})
+	if len(h.st.undo) > h.Size {
+		h.st.undo = slices.Delete(h.st.undo, 0, len(h.st.undo)-h.Size)
+	}
+	h.st.redo = nil
+	h.mu.Unlock()
+	return cout, err
+}
+
+func (h History) revert(ctx context.Context, cmd Cmd) ([]Cmd, error) {
+	n := 1
+	args := cmd.Args
+	if cmd.Target != "" {
+		v, err := strconv.Atoi(cmd.Target)
+		if err != nil || v < 1 {
+			// no count, the target is the duration
+			args = append([]string{cmd.Target}, args...)
+		} else {
+			n = v
+		}
+	}
+
+	h.mu.Lock()
+	from, to := &h.st.undo, &h.st.redo
+	if cmd.Action == "redo" {
+		from, to = to, from
+	}
+	n = min(n, len(*from))
+	cs := slices.Clone((*from)[len(*from)-n:])
+	slices.Reverse(cs)
+	if !IsDryRun(ctx) {
+		*from = (*from)[:len(*from)-n]
+		*to = append(*to, cs...)
+	}
+	h.mu.Unlock()
+	if n == 0 {
+		return nil, fmt.Errorf("nothing to %s", cmd.Action)
+	}
+
+	var cmds []Cmd
+	for _, c := range cs {
+		if cmd.Action == "redo" {
+			cmds = append(cmds, c.cmds...)
+			continue
+		}
+		for _, b := range c.before {
+			if b.Action != "switch" && len(args) > 0 {
+				b.Args = append(slices.Clone(b.Args), args[0])
+			}
+			cmds = append(cmds, b)
+		}
+	}
+	return h.Cmdr.Cmd(ctx, dedupe(context.Background(), cmds))
+}
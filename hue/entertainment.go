@@ -0,0 +1,249 @@
+package hue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/pion/dtls/v2"
+)
+
+// StreamPort is the UDP port of the bridge entertainment streaming service.
+const StreamPort = 2100
+
+// MaxChannels is the number of channels a single stream frame may carry.
+const MaxChannels = 20
+
+func (h *Client) EntertainmentConfigurations(ctx context.Context) ([]EntertainmentConfiguration, error) {
+	rsp, err := h.do(ctx, http.MethodGet, "resource/entertainment_configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	var er EntertainmentConfigurationResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&er); err != nil {
+		return nil, err
+	}
+	return er.Configurations, joinErrs(er.Errors)
+}
+
+func (h *Client) EntertainmentConfiguration(ctx context.Context, id string) (EntertainmentConfiguration, error) {
+	if !idReg.MatchString(id) {
+		return EntertainmentConfiguration{}, fmt.Errorf("invalid resource id %q", id)
+	}
+
+	rsp, err := h.do(ctx, http.MethodGet, "resource/entertainment_configuration/"+id, nil)
+	if err != nil {
+		return EntertainmentConfiguration{}, err
+	}
+	defer rsp.Body.Close()
+
+	var er EntertainmentConfigurationResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&er); err != nil {
+		return EntertainmentConfiguration{}, err
+	}
+	if len(er.Configurations) == 0 {
+		return EntertainmentConfiguration{}, joinErrs(er.Errors)
+	}
+	return er.Configurations[0], joinErrs(er.Errors)
+}
+
+func (h *Client) EntertainmentConfigurationPut(ctx context.Context, id string, req EntertainmentConfigurationPutRequest) error {
+	rsp, err := h.do(ctx, http.MethodPut, "resource/entertainment_configuration/"+id, req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	return checkPutResponse(rsp.Body)
+}
+
+func (h *Client) Entertainments(ctx context.Context) ([]Entertainment, error) {
+	rsp, err := h.do(ctx, http.MethodGet, "resource/entertainment", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	var er EntertainmentResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&er); err != nil {
+		return nil, err
+	}
+	return er.Entertainments, joinErrs(er.Errors)
+}
+
+// Stream starts the entertainment configuration id and opens a DTLS session
+// to the bridge. Frames sent on the stream are rendered by the lights in the
+// configuration until the stream is closed.
+func (h *Client) Stream(ctx context.Context, id string) (*Stream, error) {
+	if h.AppId == "" || h.ClientKey == "" {
+		return nil, errors.New("stream: AppId and ClientKey are required")
+	}
+	psk, err := hex.DecodeString(h.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("stream: client key: %w", err)
+	}
+
+	err = h.EntertainmentConfigurationPut(ctx, id, EntertainmentConfigurationPutRequest{Action: "start"})
+	if err != nil {
+		return nil, fmt.Errorf("stream: start: %w", err)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(h.Host, fmt.Sprint(StreamPort)))
+	if err != nil {
+		h.EntertainmentConfigurationPut(context.Background(), id, EntertainmentConfigurationPutRequest{Action: "stop"})
+		return nil, fmt.Errorf("stream: %w", err)
+	}
+	s, err := dialStream(ctx, addr, h.AppId, psk, id)
+	if err != nil {
+		h.EntertainmentConfigurationPut(context.Background(), id, EntertainmentConfigurationPutRequest{Action: "stop"})
+		return nil, fmt.Errorf("stream: %w", err)
+	}
+	s.stop = func() error {
+		return h.EntertainmentConfigurationPut(context.Background(), id, EntertainmentConfigurationPutRequest{Action: "stop"})
+	}
+	return s, nil
+}
+
+func dialStream(ctx context.Context, addr *net.UDPAddr, identity string, psk []byte, id string) (*Stream, error) {
+	if len(id) != 36 {
+		return nil, fmt.Errorf("invalid entertainment configuration id %q", id)
+	}
+	cfg := &dtls.Config{
+		PSK: func([]byte) ([]byte, error) {
+			return psk, nil
+		},
+		PSKIdentityHint: []byte(identity),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256},
+	}
+	conn, err := dtls.DialWithContext(ctx, "udp", addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{
+		conn: conn,
+		id:   id,
+		stop: func() error { return nil },
+	}, nil
+}
+
+// Stream is a DTLS session streaming colors to an entertainment configuration.
+type Stream struct {
+	conn net.Conn
+	id   string
+	seq  uint8
+	stop func() error
+}
+
+// ChannelRGB is the color of one entertainment channel in a stream frame.
+// Components are on the full range of uint16.
+type ChannelRGB struct {
+	Channel uint8
+	R, G, B uint16
+}
+
+// Send writes a single frame of channel colors to the stream.
+func (s *Stream) Send(chans []ChannelRGB) error {
+	if len(chans) > MaxChannels {
+		return fmt.Errorf("stream: %d channels exceeds maximum of %d", len(chans), MaxChannels)
+	}
+	_, err := s.conn.Write(s.frame(chans))
+	s.seq++
+	return err
+}
+
+func (s *Stream) frame(chans []ChannelRGB) []byte {
+	b := make([]byte, 0, 52+7*len(chans))
+	b = append(b, "HueStream"...)
+	b = append(b,
+		0x02, 0x00, // api version 2.0
+		s.seq,
+		0x00, 0x00, // reserved
+		0x00, // color space rgb
+		0x00, // reserved
+	)
+	b = append(b, s.id...)
+	for _, c := range chans {
+		b = append(b, c.Channel)
+		b = binary.BigEndian.AppendUint16(b, c.R)
+		b = binary.BigEndian.AppendUint16(b, c.G)
+		b = binary.BigEndian.AppendUint16(b, c.B)
+	}
+	return b
+}
+
+// Close ends the DTLS session and stops the entertainment configuration.
+func (s *Stream) Close() error {
+	return errors.Join(s.conn.Close(), s.stop())
+}
+
+type EntertainmentConfigurationPutRequest struct {
+	Action string `json:"action"`
+}
+
+type EntertainmentConfigurationResponse struct {
+	Configurations []EntertainmentConfiguration `json:"data"`
+	Errors         []Error                      `json:"errors"`
+}
+
+type EntertainmentConfiguration struct {
+	Id       string `json:"id"`
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	ConfigurationType string `json:"configuration_type"`
+	Status            string `json:"status"`
+	Channels          []struct {
+		ChannelId uint8 `json:"channel_id"`
+		Position  struct {
+			X float64 `json:"x"`
+			Y float64 `json:"y"`
+			Z float64 `json:"z"`
+		} `json:"position"`
+		Members []struct {
+			Service struct {
+				Rid   string `json:"rid"`
+				Rtype string `json:"rtype"`
+			} `json:"service"`
+			Index int `json:"index"`
+		} `json:"members"`
+	} `json:"channels"`
+	LightServices []struct {
+		Rid   string `json:"rid"`
+		Rtype string `json:"rtype"`
+	} `json:"light_services"`
+	Type string `json:"type"`
+}
+
+type EntertainmentResponse struct {
+	Entertainments []Entertainment `json:"data"`
+	Errors         []Error         `json:"errors"`
+}
+
+type Entertainment struct {
+	Id    string `json:"id"`
+	Owner struct {
+		Rid   string `json:"rid"`
+		Rtype string `json:"rtype"`
+	} `json:"owner"`
+	Renderer          bool `json:"renderer"`
+	RendererReference *struct {
+		Rid   string `json:"rid"`
+		Rtype string `json:"rtype"`
+	} `json:"renderer_reference"`
+	Segments *struct {
+		Configurable bool `json:"configurable"`
+		MaxSegments  int  `json:"max_segments"`
+		Segments     []struct {
+			Length int `json:"length"`
+			Start  int `json:"start"`
+		} `json:"segments"`
+	} `json:"segments"`
+	Type string `json:"type"`
+}
@@ -0,0 +1,88 @@
+package hue
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/dtls/v2"
+)
+
+func TestStream(t *testing.T) {
+	var (
+		psk = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+		id  = "0f16ff4e-b162-4fc1-8489-6a7c0419e2d4"
+	)
+	ln, err := dtls.Listen("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, &dtls.Config{
+		PSK: func([]byte) ([]byte, error) {
+			return psk, nil
+		},
+		CipherSuites: []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256},
+	})
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	defer ln.Close()
+
+	frames := make(chan []byte)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(frames)
+			return
+		}
+		defer conn.Close()
+		for {
+			b := make([]byte, 1024)
+			n, err := conn.Read(b)
+			if err != nil {
+				close(frames)
+				return
+			}
+			frames <- b[:n]
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s, err := dialStream(ctx, ln.Addr().(*net.UDPAddr), "disco", psk, id)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	defer s.Close()
+
+	for seq := 0; seq < 2; seq++ {
+		err = s.Send([]ChannelRGB{
+			{Channel: 0, R: 0xffff, G: 0x0000, B: 0x8000},
+			{Channel: 3, R: 0x0001, G: 0x0203, B: 0x0405},
+		})
+		if err != nil {
+			t.Fatalf("send: %s", err)
+		}
+
+		ex := append([]byte("HueStream"), 0x02, 0x00, byte(seq), 0x00, 0x00, 0x00, 0x00)
+		ex = append(ex, id...)
+		ex = append(ex,
+			0x00, 0xff, 0xff, 0x00, 0x00, 0x80, 0x00,
+			0x03, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05,
+		)
+		select {
+		case b := <-frames:
+			if !bytes.Equal(b, ex) {
+				t.Errorf("expected\n  % x\ngot\n  % x", ex, b)
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for frame")
+		}
+	}
+}
+
+func TestStreamTooManyChannels(t *testing.T) {
+	s := &Stream{id: "0f16ff4e-b162-4fc1-8489-6a7c0419e2d4"}
+	err := s.Send(make([]ChannelRGB, MaxChannels+1))
+	if err == nil {
+		t.Error("expected error")
+	}
+}
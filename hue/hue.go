@@ -19,6 +19,16 @@ import (
 type Config struct {
 	Host string
 	Key  string
+
+	// AppId and ClientKey are the PSK identity and hex encoded PSK used to
+	// open an entertainment stream.
+	AppId     string
+	ClientKey string
+	// Area is the id of the entertainment configuration to stream to. When
+	// set, commands for lights in the area are rendered into the stream.
+	Area string
+	// Rate is the stream frame rate in Hz.
+	Rate int
 }
 
 type Client struct {
@@ -39,7 +49,7 @@ func New(c Config) *Client {
 	return &Client{c, cl}
 }
 
-func (h *Client) do(meth, path string, v any) (*http.Response, error) {
+func (h *Client) do(ctx context.Context, meth, path string, v any) (*http.Response, error) {
 	s, err := url.JoinPath("https://", h.Host, "clip/v2", path)
 	if err != nil {
 		return nil, err
@@ -53,7 +63,7 @@ func (h *Client) do(meth, path string, v any) (*http.Response, error) {
 		}
 	}
 
-	req, err := http.NewRequest(meth, s, &bb)
+	req, err := http.NewRequestWithContext(ctx, meth, s, &bb)
 	if err != nil {
 		return nil, err
 	}
@@ -68,8 +78,8 @@ func (h *Client) do(meth, path string, v any) (*http.Response, error) {
 	return rsp, nil
 }
 
-func (h *Client) Lights() ([]Light, error) {
-	rsp, err := h.do(http.MethodGet, "resource/light", nil)
+func (h *Client) Lights(ctx context.Context) ([]Light, error) {
+	rsp, err := h.do(ctx, http.MethodGet, "resource/light", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -83,12 +93,12 @@ func (h *Client) Lights() ([]Light, error) {
 	return lr.Lights, joinErrs(lr.Errors)
 }
 
-func (h *Client) Light(id string) (Light, error) {
+func (h *Client) Light(ctx context.Context, id string) (Light, error) {
 	if !idReg.MatchString(id) {
 		return Light{}, fmt.Errorf("invalid resource id %q", id)
 	}
 
-	rsp, err := h.do(http.MethodGet, "resource/light/"+id, nil)
+	rsp, err := h.do(ctx, http.MethodGet, "resource/light/"+id, nil)
 	if err != nil {
 		return Light{}, err
 	}
@@ -104,8 +114,8 @@ func (h *Client) Light(id string) (Light, error) {
 	return lr.Lights[0], joinErrs(lr.Errors)
 }
 
-func (h *Client) LightPut(id string, req LightPutRequest) error {
-	rsp, err := h.do(http.MethodPut, "resource/light/"+id, req)
+func (h *Client) LightPut(ctx context.Context, id string, req LightPutRequest) error {
+	rsp, err := h.do(ctx, http.MethodPut, "resource/light/"+id, req)
 	if err != nil {
 		return err
 	}
@@ -114,6 +124,21 @@ func (h *Client) LightPut(id string, req LightPutRequest) error {
 	return checkPutResponse(rsp.Body)
 }
 
+func (h *Client) ZigbeeConnectivity(ctx context.Context) ([]ZigbeeConnectivity, error) {
+	rsp, err := h.do(ctx, http.MethodGet, "resource/zigbee_connectivity", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	var zr ZigbeeConnectivityResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&zr); err != nil {
+		return nil, err
+	}
+
+	return zr.Connectivity, joinErrs(zr.Errors)
+}
+
 func (h *Client) Watch(ctx context.Context) (<-chan Event, error) {
 	s, err := url.JoinPath("https://", h.Host, "eventstream/clip/v2")
 	if err != nil {
@@ -189,6 +214,7 @@ func NewLightPutColor(x, y float64) *LightPutColor {
 
 type LightPutGradient struct {
 	Points []Point `json:"points"`
+	Mode   string  `json:"mode,omitempty"`
 }
 
 type Point struct {
@@ -321,6 +347,21 @@ type Light struct {
 	Type string `json:"type"`
 }
 
+type ZigbeeConnectivityResponse struct {
+	Connectivity []ZigbeeConnectivity `json:"data"`
+	Errors       []Error              `json:"errors"`
+}
+
+type ZigbeeConnectivity struct {
+	Id    string `json:"id"`
+	Owner struct {
+		Rid   string `json:"rid"`
+		Rtype string `json:"rtype"`
+	} `json:"owner"`
+	Status string `json:"status"`
+	Type   string `json:"type"`
+}
+
 type Error struct {
 	Description string `json:"description"`
 }
@@ -345,23 +386,48 @@ type Event struct {
 }
 
 type EventData struct {
-	Color   *Color `json:"color"`
+	Button *struct {
+		ButtonReport *struct {
+			Event   string `json:"event"`
+			Updated string `json:"updated"`
+		} `json:"button_report"`
+		LastEvent string `json:"last_event"`
+	} `json:"button"`
+	Color            *Color `json:"color"`
+	ColorTemperature *struct {
+		Mirek      *int `json:"mirek"`
+		MirekValid bool `json:"mirek_valid"`
+	} `json:"color_temperature"`
 	Dimming *struct {
 		Brightness float64 `json:"brightness"`
 	} `json:"dimming"`
 	Gradient *struct {
+		Mode          string  `json:"mode"`
 		Points        []Point `json:"points"`
 		PointsCapable float64 `json:"points_capable"`
 	} `json:"gradient"`
-	Id   string `json:"id"`
-	IdV1 string `json:"id_v1"`
-	On   *struct {
+	Id    string `json:"id"`
+	IdV1  string `json:"id_v1"`
+	Light *struct {
+		LightLevel      *int `json:"light_level"`
+		LightLevelValid bool `json:"light_level_valid"`
+	} `json:"light"`
+	Motion *struct {
+		Motion      *bool `json:"motion"`
+		MotionValid bool  `json:"motion_valid"`
+	} `json:"motion"`
+	On *struct {
 		On bool `json:"on"`
 	} `json:"on"`
 	Owner struct {
 		Rid   string `json:"rid"`
 		Rtype string `json:"rtype"`
 	} `json:"owner"`
+	Status      string `json:"status"`
+	Temperature *struct {
+		Temperature      *float64 `json:"temperature"`
+		TemperatureValid bool     `json:"temperature_valid"`
+	} `json:"temperature"`
 	Type string `json:"type"`
 }
 
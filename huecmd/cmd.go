@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dedelala/disco"
 	"github.com/dedelala/disco/color"
@@ -16,7 +19,7 @@ type Cmdr struct {
 	*hue.Client
 }
 
-func (c Cmdr) Cmd(cmds []disco.Cmd) ([]disco.Cmd, error) {
+func (c Cmdr) Cmd(ctx context.Context, cmds []disco.Cmd) ([]disco.Cmd, error) {
 	var (
 		cout   []disco.Cmd
 		errs   error
@@ -24,15 +27,16 @@ func (c Cmdr) Cmd(cmds []disco.Cmd) ([]disco.Cmd, error) {
 		dcreqs = map[string]hue.LightPutRequest{}
 	)
 
-	ls, err := c.Lights()
+	ls, err := c.Lights(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("hue: %w", err)
+		return nil, err
 	}
 	lm := map[string]hue.Light{}
 	for _, l := range ls {
 		lm[l.Id] = l
 	}
 
+	var conn map[string]bool
 	for _, cmd := range cmds {
 		var (
 			cs  []disco.Cmd
@@ -45,28 +49,82 @@ func (c Cmdr) Cmd(cmds []disco.Cmd) ([]disco.Cmd, error) {
 			cs, err = cmdDim(cmd, lm, dcreqs)
 		case "color":
 			cs, err = cmdColor(cmd, lm, dcreqs)
+		case "gradient":
+			cs, err = cmdGradient(cmd, lm, dcreqs)
+		case "status":
+			if conn == nil {
+				conn, err = c.connectivity(ctx)
+				if err != nil {
+					break
+				}
+			}
+			cs, err = cmdStatus(cmd, lm, conn)
 		}
 		cout = append(cout, cs...)
 		errs = errors.Join(errs, err)
 	}
 
+	if disco.IsDryRun(ctx) {
+		for id, req := range sreqs {
+			cout = append(cout, disco.RequestCmd(id, req))
+		}
+		for id, req := range dcreqs {
+			cout = append(cout, disco.RequestCmd(id, req))
+		}
+		return cout, errs
+	}
+
 	for id, req := range sreqs {
-		err := c.LightPut(id, req)
+		err := c.LightPut(ctx, id, req)
 		if err != nil {
-			errs = errors.Join(errs, err)
+			errs = errors.Join(errs, disco.TargetErr(id, err))
 		}
 	}
 
 	for id, req := range dcreqs {
-		err := c.LightPut(id, req)
+		err := c.LightPut(ctx, id, req)
 		if err != nil {
-			errs = errors.Join(errs, err)
+			errs = errors.Join(errs, disco.TargetErr(id, err))
 		}
 	}
 
 	return cout, errs
 }
 
+// connectivity returns whether each device is connected to the bridge.
+func (c Cmdr) connectivity(ctx context.Context) (map[string]bool, error) {
+	zs, err := c.ZigbeeConnectivity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn := map[string]bool{}
+	for _, z := range zs {
+		conn[z.Owner.Rid] = z.Status == "connected"
+	}
+	return conn, nil
+}
+
+// cmdStatus reports whether lights are reachable. Lights of devices without
+// zigbee connectivity are taken to be reachable.
+func cmdStatus(cmd disco.Cmd, ls map[string]hue.Light, conn map[string]bool) ([]disco.Cmd, error) {
+	status := func(l hue.Light) disco.Cmd {
+		r, ok := conn[l.Owner.Rid]
+		return disco.StatusCmd(l.Id, r || !ok)
+	}
+	if cmd.Target == "" {
+		var cout []disco.Cmd
+		for _, l := range ls {
+			cout = append(cout, status(l))
+		}
+		return cout, nil
+	}
+	l, ok := ls[cmd.Target]
+	if !ok {
+		return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
+	}
+	return []disco.Cmd{status(l)}, nil
+}
+
 func cmdSwitch(cmd disco.Cmd, ls map[string]hue.Light, reqs map[string]hue.LightPutRequest) ([]disco.Cmd, error) {
 	if cmd.Target == "" {
 		var cout []disco.Cmd
@@ -77,14 +135,14 @@ func cmdSwitch(cmd disco.Cmd, ls map[string]hue.Light, reqs map[string]hue.Light
 	}
 	l, ok := ls[cmd.Target]
 	if !ok {
-		return nil, fmt.Errorf("hue: has no target %s", cmd.Target)
+		return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
 	}
 	if len(cmd.Args) == 0 {
 		return []disco.Cmd{disco.SwitchCmd(l.Id, l.On.On)}, nil
 	}
 	on, err := disco.ParseSwitch(cmd.Args[0])
 	if err != nil {
-		return nil, fmt.Errorf("hue: %s: %w", cmd.Target, err)
+		return nil, disco.TargetErr(cmd.Target, err)
 	}
 	reqs[cmd.Target] = hue.LightPutRequest{
 		On: &hue.LightPutOn{On: on},
@@ -107,10 +165,10 @@ func cmdDim(cmd disco.Cmd, ls map[string]hue.Light, reqs map[string]hue.LightPut
 	id, _, _ := strings.Cut(cmd.Target, "/")
 	l, ok := ls[id]
 	if !ok {
-		return nil, fmt.Errorf("hue: has no target %s", id)
+		return nil, disco.TargetErr(id, disco.ErrNotFound)
 	}
 	if l.Dimming == nil {
-		return nil, fmt.Errorf("hue: has no dimming %s", id)
+		return nil, disco.TargetErr(id, fmt.Errorf("%w: has no dimming", disco.ErrUnsupported))
 	}
 	if len(cmd.Args) == 0 {
 		return []disco.Cmd{disco.DimCmd(l.Id, l.Dimming.Brightness)}, nil
@@ -118,17 +176,17 @@ func cmdDim(cmd disco.Cmd, ls map[string]hue.Light, reqs map[string]hue.LightPut
 
 	v, err := disco.ParseDim(cmd.Args[0])
 	if err != nil {
-		return nil, fmt.Errorf("hue: %s: %w", id, err)
+		return nil, disco.TargetErr(id, err)
 	}
 	req := reqs[id]
 	req.Dimming = &hue.LightPutDimming{Brightness: v}
 
 	d, err := disco.ParseDuration(cmd.Args)
 	if err != nil {
-		return nil, fmt.Errorf("hue: %s: %w", id, err)
+		return nil, disco.TargetErr(id, err)
 	}
 	if req.Dynamics != nil && req.Dynamics.Duration != d.Milliseconds() {
-		return nil, fmt.Errorf("hue: %s: commands have conflicting durations", id)
+		return nil, disco.TargetErr(id, errors.New("commands have conflicting durations"))
 	}
 	if req.Dynamics == nil {
 		req.Dynamics = &hue.LightPutDynamics{Duration: d.Milliseconds()}
@@ -150,10 +208,10 @@ func cmdColor(cmd disco.Cmd, ls map[string]hue.Light, reqs map[string]hue.LightP
 	id, index, isPoint := strings.Cut(cmd.Target, "/")
 	l, ok := ls[id]
 	if !ok {
-		return nil, fmt.Errorf("hue: has no target %s", cmd.Target)
+		return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
 	}
 	if l.Color == nil {
-		return nil, fmt.Errorf("hue: has no color %s", cmd.Target)
+		return nil, disco.TargetErr(cmd.Target, fmt.Errorf("%w: has no color", disco.ErrUnsupported))
 	}
 
 	if len(cmd.Args) == 0 {
@@ -163,7 +221,7 @@ func cmdColor(cmd disco.Cmd, ls map[string]hue.Light, reqs map[string]hue.LightP
 		}
 		i, err := strconv.Atoi(index)
 		if err != nil || i < 0 || i >= len(cout) {
-			return nil, fmt.Errorf("hue: has no target %s", cmd.Target)
+			return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
 		}
 		return cout[i : i+1], nil
 	}
@@ -171,10 +229,10 @@ func cmdColor(cmd disco.Cmd, ls map[string]hue.Light, reqs map[string]hue.LightP
 	req := reqs[id]
 	d, err := disco.ParseDuration(cmd.Args)
 	if err != nil {
-		return nil, fmt.Errorf("hue: %s: %w", cmd.Target, err)
+		return nil, disco.TargetErr(cmd.Target, err)
 	}
 	if req.Dynamics != nil && req.Dynamics.Duration != d.Milliseconds() {
-		return nil, fmt.Errorf("hue: %s: commands have conflicting durations", cmd.Target)
+		return nil, disco.TargetErr(cmd.Target, errors.New("commands have conflicting durations"))
 	}
 	if req.Dynamics == nil {
 		req.Dynamics = &hue.LightPutDynamics{Duration: d.Milliseconds()}
@@ -182,16 +240,14 @@ func cmdColor(cmd disco.Cmd, ls map[string]hue.Light, reqs map[string]hue.LightP
 
 	clr, err := color.Parse(cmd.Args[0])
 	if err != nil {
-		return nil, fmt.Errorf("hue: %s: %w", cmd.Target, err)
+		return nil, disco.TargetErr(cmd.Target, err)
 	}
 
 	if clr.HasK() {
 		if l.ColorTemperature == nil {
-			return nil, fmt.Errorf("hue: %s has no mirek", cmd.Target)
+			return nil, disco.TargetErr(cmd.Target, fmt.Errorf("%w: has no mirek", disco.ErrUnsupported))
 		}
-		k := clr.Kf()
-		v := k * float64(l.ColorTemperature.MirekSchema.MirekMaximum-l.ColorTemperature.MirekSchema.MirekMinimum)
-		m := l.ColorTemperature.MirekSchema.MirekMinimum + int(v)
+		m := clrMirek(clr, l.ColorTemperature.MirekSchema.MirekMinimum, l.ColorTemperature.MirekSchema.MirekMaximum)
 		req.ColorTemperature = &hue.LightPutColorTemperature{Mirek: m}
 		reqs[id] = req
 		return nil, nil
@@ -211,13 +267,20 @@ func cmdColor(cmd disco.Cmd, ls map[string]hue.Light, reqs map[string]hue.LightP
 		return nil, nil
 	}
 
-	points := l.Gradient.Points
+	if l.Gradient == nil {
+		return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
+	}
+	// points set in the same call add up
+	points := slices.Clone(l.Gradient.Points)
+	if req.Gradient != nil {
+		points = req.Gradient.Points
+	}
 	for len(points) < l.Gradient.PointsCapable {
 		points = append(points, hue.NewPoint(l.Color.XY.X, l.Color.XY.Y))
 	}
 	i, err := strconv.Atoi(index)
 	if err != nil || i < 0 || i >= l.Gradient.PointsCapable {
-		return nil, fmt.Errorf("hue: has no target %s", cmd.Target)
+		return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
 	}
 	points[i] = hue.NewPoint(x, y)
 	req.Gradient = &hue.LightPutGradient{Points: points}
@@ -230,7 +293,17 @@ func cmdColorGet(l hue.Light) []disco.Cmd {
 		return nil
 	}
 
-	clr := color.XYBfPhilipsWideRGBD65(l.Color.XY.X, l.Color.XY.Y, 1.0)
+	var (
+		clr = color.XYBfPhilipsWideRGBD65(l.Color.XY.X, l.Color.XY.Y, 1.0)
+		ct  = l.ColorTemperature != nil && l.ColorTemperature.MirekValid && l.ColorTemperature.Mirek != nil
+	)
+	if ct {
+		clr = mirekClr(
+			*l.ColorTemperature.Mirek,
+			l.ColorTemperature.MirekSchema.MirekMinimum,
+			l.ColorTemperature.MirekSchema.MirekMaximum,
+		)
+	}
 
 	if l.Gradient == nil {
 		return []disco.Cmd{disco.ColorCmd(l.Id, clr)}
@@ -239,7 +312,7 @@ func cmdColorGet(l hue.Light) []disco.Cmd {
 	var cout []disco.Cmd
 	for i := 0; i < l.Gradient.PointsCapable; i++ {
 		id := fmt.Sprintf("%s/%d", l.Id, i)
-		if i >= len(l.Gradient.Points) {
+		if ct || i >= len(l.Gradient.Points) {
 			cout = append(cout, disco.ColorCmd(id, clr))
 			continue
 		}
@@ -253,7 +326,160 @@ func cmdColorGet(l hue.Light) []disco.Cmd {
 	return cout
 }
 
+// mirekClr encodes the color temperature m within the schema range lo to hi
+// into the K component of a Color. The RGB components approximate the color
+// temperature as encoded, so that equal K components give equal colors.
+func mirekClr(m, lo, hi int) color.Color {
+	var k float64
+	if hi > lo {
+		k = float64(m-lo) / float64(hi-lo)
+	}
+	k = color.Color(0).WithKf(k).Kf()
+	mk := float64(lo) + k*float64(hi-lo)
+	return color.Kelvin(1e6 / max(mk, 1)).WithKf(k)
+}
+
+// clrMirek is the inverse of mirekClr.
+func clrMirek(clr color.Color, lo, hi int) int {
+	return lo + int(math.Round(clr.Kf()*float64(hi-lo)))
+}
+
+type mirekSchema struct {
+	lo, hi int
+}
+
+var gradientModes = map[string]string{
+	"interpolated": "interpolated_palette",
+	"mirrored":     "interpolated_palette_mirrored",
+	"pixelated":    "random_pixelated",
+}
+
+func parseGradientMode(s string) (string, bool) {
+	if m, ok := gradientModes[s]; ok {
+		return m, true
+	}
+	for _, m := range gradientModes {
+		if s == m {
+			return m, true
+		}
+	}
+	return "", false
+}
+
+func gradientModeName(mode string) string {
+	for s, m := range gradientModes {
+		if m == mode {
+			return s
+		}
+	}
+	return mode
+}
+
+func cmdGradient(cmd disco.Cmd, ls map[string]hue.Light, reqs map[string]hue.LightPutRequest) ([]disco.Cmd, error) {
+	if cmd.Target == "" {
+		var cout []disco.Cmd
+		for _, l := range ls {
+			if l.Gradient == nil {
+				continue
+			}
+			cout = append(cout, cmdGradientGet(l))
+		}
+		return cout, nil
+	}
+
+	l, ok := ls[cmd.Target]
+	if !ok {
+		return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
+	}
+	if l.Color == nil || l.Gradient == nil {
+		return nil, disco.TargetErr(cmd.Target, fmt.Errorf("%w: has no gradient", disco.ErrUnsupported))
+	}
+	if len(cmd.Args) == 0 {
+		return []disco.Cmd{cmdGradientGet(l)}, nil
+	}
+
+	var (
+		args = cmd.Args
+		d    = 3 * time.Second
+		req  = reqs[cmd.Target]
+		grad = &hue.LightPutGradient{Points: l.Gradient.Points}
+	)
+	if m, ok := parseGradientMode(args[0]); ok {
+		if !slices.Contains(l.Gradient.ModeValues, m) {
+			return nil, disco.TargetErr(cmd.Target, fmt.Errorf("%w: gradient mode %s", disco.ErrUnsupported, args[0]))
+		}
+		grad.Mode = m
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		if v, err := time.ParseDuration(args[len(args)-1]); err == nil {
+			d = v
+			args = args[:len(args)-1]
+		}
+	}
+
+	if len(args) > 0 {
+		if len(args) < 2 || len(args) > l.Gradient.PointsCapable {
+			return nil, disco.TargetErr(cmd.Target, fmt.Errorf("gradient takes 2 to %d colors", l.Gradient.PointsCapable))
+		}
+		grad.Points = nil
+		for _, arg := range args {
+			clr, err := color.Parse(arg)
+			if err != nil {
+				return nil, disco.TargetErr(cmd.Target, err)
+			}
+			if clr.HasK() {
+				return nil, disco.TargetErr(cmd.Target, errors.New("gradient colors have no temperature"))
+			}
+			x, y, _ := clr.XYBfPhilipsWideRGBD65()
+			x, y = color.BoundToGamutXY(
+				x, y,
+				l.Color.Gamut.Red.X, l.Color.Gamut.Red.Y,
+				l.Color.Gamut.Green.X, l.Color.Gamut.Green.Y,
+				l.Color.Gamut.Blue.X, l.Color.Gamut.Blue.Y,
+			)
+			grad.Points = append(grad.Points, hue.NewPoint(x, y))
+		}
+	}
+
+	if req.Dynamics != nil && req.Dynamics.Duration != d.Milliseconds() {
+		return nil, disco.TargetErr(cmd.Target, errors.New("commands have conflicting durations"))
+	}
+	if req.Dynamics == nil {
+		req.Dynamics = &hue.LightPutDynamics{Duration: d.Milliseconds()}
+	}
+	req.Gradient = grad
+	reqs[cmd.Target] = req
+	return nil, nil
+}
+
+func cmdGradientGet(l hue.Light) disco.Cmd {
+	args := []string{gradientModeName(l.Gradient.Mode)}
+	for _, p := range l.Gradient.Points {
+		clr := color.XYBfPhilipsWideRGBD65(p.Color.XY.X, p.Color.XY.Y, 1.0)
+		args = append(args, clr.String())
+	}
+	return disco.Cmd{Action: "gradient", Target: l.Id, Args: args}
+}
+
 func (c Cmdr) Watch(ctx context.Context) (<-chan disco.Cmd, error) {
+	ls, err := c.Lights(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schemas := map[string]mirekSchema{}
+	owned := map[string][]string{}
+	for _, l := range ls {
+		owned[l.Owner.Rid] = append(owned[l.Owner.Rid], l.Id)
+		if l.ColorTemperature == nil {
+			continue
+		}
+		schemas[l.Id] = mirekSchema{
+			l.ColorTemperature.MirekSchema.MirekMinimum,
+			l.ColorTemperature.MirekSchema.MirekMaximum,
+		}
+	}
+
 	events, err := c.Client.Watch(ctx)
 	if err != nil {
 		return nil, err
@@ -261,12 +487,13 @@ func (c Cmdr) Watch(ctx context.Context) (<-chan disco.Cmd, error) {
 
 	cout := make(chan disco.Cmd)
 	go func() {
+		ct := map[string]bool{}
 		for e := range events {
 			if e.Type != "update" {
 				continue
 			}
 			for _, d := range e.Data {
-				watchEventData(cout, d)
+				watchEventData(cout, d, schemas, owned, ct)
 			}
 		}
 		close(cout)
@@ -274,8 +501,18 @@ func (c Cmdr) Watch(ctx context.Context) (<-chan disco.Cmd, error) {
 	return cout, nil
 }
 
-func watchEventData(cout chan<- disco.Cmd, d hue.EventData) {
-	if d.Type != "light" {
+func watchEventData(cout chan<- disco.Cmd, d hue.EventData, schemas map[string]mirekSchema, owned map[string][]string, ct map[string]bool) {
+	switch d.Type {
+	case "light":
+	case "zigbee_connectivity":
+		for _, id := range owned[d.Owner.Rid] {
+			cout <- disco.StatusCmd(id, d.Status == "connected")
+		}
+		return
+	case "button", "motion", "temperature", "light_level":
+		watchSensorData(cout, d)
+		return
+	default:
 		return
 	}
 	if d.On != nil {
@@ -284,15 +521,67 @@ func watchEventData(cout chan<- disco.Cmd, d hue.EventData) {
 	if d.Dimming != nil {
 		cout <- disco.DimCmd(d.Id, d.Dimming.Brightness)
 	}
-	if d.Color != nil {
+	if d.ColorTemperature != nil {
+		ct[d.Id] = d.ColorTemperature.MirekValid && d.ColorTemperature.Mirek != nil
+		if s, ok := schemas[d.Id]; ok && ct[d.Id] {
+			cout <- disco.ColorCmd(d.Id, mirekClr(*d.ColorTemperature.Mirek, s.lo, s.hi))
+		}
+	}
+	if d.Color != nil && !ct[d.Id] {
 		c := color.XYBfPhilipsWideRGBD65(d.Color.XY.X, d.Color.XY.Y, 1.0)
 		cout <- disco.ColorCmd(d.Id, c)
 	}
-	if d.Gradient != nil {
+	if d.Gradient != nil && !ct[d.Id] {
+		var args []string
+		if d.Gradient.Mode != "" {
+			args = append(args, gradientModeName(d.Gradient.Mode))
+		}
 		for i, p := range d.Gradient.Points {
 			c := color.XYBfPhilipsWideRGBD65(p.Color.XY.X, p.Color.XY.Y, 1.0)
 			id := fmt.Sprintf("%s/%d", d.Id, i)
 			cout <- disco.ColorCmd(id, c)
+			args = append(args, c.String())
+		}
+		if len(d.Gradient.Points) > 0 {
+			cout <- disco.Cmd{Action: "gradient", Target: d.Id, Args: args}
+		}
+	}
+}
+
+func watchSensorData(cout chan<- disco.Cmd, d hue.EventData) {
+	switch {
+	case d.Button != nil:
+		e := d.Button.LastEvent
+		if d.Button.ButtonReport != nil {
+			e = d.Button.ButtonReport.Event
+		}
+		if e != "" {
+			cout <- disco.Cmd{Action: "button", Target: d.Id, Args: []string{e}}
+		}
+	case d.Motion != nil:
+		if d.Motion.MotionValid && d.Motion.Motion != nil {
+			cout <- disco.Cmd{
+				Action: "motion",
+				Target: d.Id,
+				Args:   []string{map[bool]string{true: "on", false: "off"}[*d.Motion.Motion]},
+			}
+		}
+	case d.Temperature != nil:
+		if d.Temperature.TemperatureValid && d.Temperature.Temperature != nil {
+			cout <- disco.Cmd{
+				Action: "temperature",
+				Target: d.Id,
+				Args:   []string{strconv.FormatFloat(*d.Temperature.Temperature, 'f', 1, 64)},
+			}
+		}
+	case d.Light != nil:
+		if d.Light.LightLevelValid && d.Light.LightLevel != nil {
+			lux := math.Pow(10, float64(*d.Light.LightLevel-1)/10000)
+			cout <- disco.Cmd{
+				Action: "light_level",
+				Target: d.Id,
+				Args:   []string{fmt.Sprintf("%.f", lux)},
+			}
 		}
 	}
 }
@@ -0,0 +1,226 @@
+package huecmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dedelala/disco"
+	"github.com/dedelala/disco/hue"
+)
+
+func TestMirekRoundTrip(t *testing.T) {
+	var schemas = []mirekSchema{
+		{153, 500},
+		{153, 454},
+		{50, 1000},
+		{200, 300},
+	}
+	for _, s := range schemas {
+		for m := s.lo; m <= s.hi; m++ {
+			c := mirekClr(m, s.lo, s.hi)
+			if !c.HasK() {
+				t.Fatalf("%d %v: expected K component in %s", m, s, c)
+			}
+			rt := mirekClr(clrMirek(c, s.lo, s.hi), s.lo, s.hi)
+			if rt != c {
+				t.Errorf("%d %v: expected %s got %s", m, s, c, rt)
+			}
+		}
+	}
+}
+
+func TestGradient(t *testing.T) {
+	var l hue.Light
+	err := json.Unmarshal([]byte(`{
+		"id": "0f16ff4e-b162-4fc1-8489-6a7c0419e2d4",
+		"color": {
+			"gamut": {
+				"red": {"x": 0.6915, "y": 0.3083},
+				"green": {"x": 0.17, "y": 0.7},
+				"blue": {"x": 0.1532, "y": 0.0475}
+			},
+			"xy": {"x": 0.3, "y": 0.3}
+		},
+		"gradient": {
+			"mode": "interpolated_palette",
+			"mode_values": ["interpolated_palette", "interpolated_palette_mirrored", "random_pixelated"],
+			"points": [],
+			"points_capable": 5
+		}
+	}`), &l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls := map[string]hue.Light{l.Id: l}
+
+	var zs = []struct {
+		args   string
+		mode   string
+		points int
+		ms     int64
+		err    bool
+	}{
+		{"ff0000 0000ff", "", 2, 3000, false},
+		{"mirrored ff0000 00ff00 0000ff 6s", "interpolated_palette_mirrored", 3, 6000, false},
+		{"pixelated", "random_pixelated", 0, 3000, false},
+		{"ff0000", "", 0, 0, true},
+		{"ff0000 ff0000 ff0000 ff0000 ff0000 ff0000", "", 0, 0, true},
+		{"sideways ff0000 0000ff", "", 0, 0, true},
+	}
+	for _, z := range zs {
+		reqs := map[string]hue.LightPutRequest{}
+		cmd := disco.ParseCmdString("gradient " + l.Id + " " + z.args)
+		_, err := cmdGradient(cmd, ls, reqs)
+		if z.err {
+			if err == nil {
+				t.Errorf("%s: expected error", z.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected: %s", z.args, err)
+			continue
+		}
+		r := reqs[l.Id]
+		if r.Gradient.Mode != z.mode || len(r.Gradient.Points) != z.points || r.Dynamics.Duration != z.ms {
+			t.Errorf("%s: expected %s %d %d got %s %d %d", z.args, z.mode, z.points, z.ms,
+				r.Gradient.Mode, len(r.Gradient.Points), r.Dynamics.Duration)
+		}
+	}
+
+	// points set in the same call add up
+	reqs := map[string]hue.LightPutRequest{}
+	for _, s := range []string{"color " + l.Id + "/0 ff0000", "color " + l.Id + "/1 0000ff"} {
+		if _, err := cmdColor(disco.ParseCmdString(s), ls, reqs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ps := reqs[l.Id].Gradient.Points
+	if len(ps) != 5 || ps[0].Color.XY == l.Color.XY || ps[1].Color.XY == l.Color.XY || ps[2].Color.XY != l.Color.XY {
+		t.Errorf("expected points 0 and 1 set got %+v", ps)
+	}
+	if len(l.Gradient.Points) != 0 {
+		t.Errorf("expected the light to be left alone got %+v", l.Gradient.Points)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			t.Errorf("unexpected %s %s", req.Method, req.URL)
+			return
+		}
+		w.Write([]byte(`{"data": [{
+			"id": "0f16ff4e-b162-4fc1-8489-6a7c0419e2d4",
+			"on": {"on": false},
+			"dimming": {"brightness": 20}
+		}]}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	c := Cmdr{Client: hue.New(hue.Config{Host: u.Host})}
+
+	ctx := disco.WithDryRun(context.Background())
+	cmds, err := c.Cmd(ctx, []disco.Cmd{
+		disco.ParseCmdString("switch 0f16ff4e-b162-4fc1-8489-6a7c0419e2d4 on"),
+		disco.ParseCmdString("dim 0f16ff4e-b162-4fc1-8489-6a7c0419e2d4 150"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "dimming values range") {
+		t.Errorf("expected dim error got %v", err)
+	}
+	if len(cmds) != 1 || cmds[0].String() != `request 0f16ff4e-b162-4fc1-8489-6a7c0419e2d4 {"on":{"on":true}}` {
+		t.Errorf("unexpected requests %v", cmds)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	var (
+		ls   []hue.Light
+		zs   []hue.ZigbeeConnectivity
+		data []hue.EventData
+	)
+	for v, s := range map[any]string{
+		&ls: `[
+			{"id": "l1", "owner": {"rid": "d1", "rtype": "device"}},
+			{"id": "l2", "owner": {"rid": "d2", "rtype": "device"}},
+			{"id": "l3", "owner": {"rid": "d3", "rtype": "device"}}
+		]`,
+		&zs: `[
+			{"id": "z1", "owner": {"rid": "d1"}, "status": "connected"},
+			{"id": "z2", "owner": {"rid": "d2"}, "status": "connectivity_issue"}
+		]`,
+		&data: `[
+			{"id": "z2", "type": "zigbee_connectivity", "owner": {"rid": "d2"}, "status": "connected"}
+		]`,
+	} {
+		if err := json.Unmarshal([]byte(s), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lm := map[string]hue.Light{}
+	owned := map[string][]string{}
+	for _, l := range ls {
+		lm[l.Id] = l
+		owned[l.Owner.Rid] = append(owned[l.Owner.Rid], l.Id)
+	}
+	conn := map[string]bool{}
+	for _, z := range zs {
+		conn[z.Owner.Rid] = z.Status == "connected"
+	}
+	for id, want := range map[string]string{
+		"l1": "status l1 reachable",
+		"l2": "status l2 unreachable",
+		"l3": "status l3 reachable",
+	} {
+		cs, err := cmdStatus(disco.Cmd{Action: "status", Target: id}, lm, conn)
+		if err != nil || len(cs) != 1 || cs[0].String() != want {
+			t.Errorf("expected %s got %v %v", want, cs, err)
+		}
+	}
+
+	cout := make(chan disco.Cmd, 1)
+	watchEventData(cout, data[0], nil, owned, map[string]bool{})
+	if got := (<-cout).String(); got != "status l2 reachable" {
+		t.Errorf("expected status l2 reachable got %s", got)
+	}
+}
+
+func TestSensors(t *testing.T) {
+	var zs = []struct {
+		data string
+		ex   string
+	}{
+		{`{"id": "b1", "type": "button", "button": {"button_report": {"event": "short_release"}, "last_event": "initial_press"}}`, "button b1 short_release"},
+		{`{"id": "b1", "type": "button", "button": {"last_event": "long_press"}}`, "button b1 long_press"},
+		{`{"id": "m1", "type": "motion", "motion": {"motion": true, "motion_valid": true}}`, "motion m1 on"},
+		{`{"id": "m1", "type": "motion", "motion": {"motion": false, "motion_valid": true}}`, "motion m1 off"},
+		{`{"id": "m1", "type": "motion", "motion": {"motion": true, "motion_valid": false}}`, ""},
+		{`{"id": "t1", "type": "temperature", "temperature": {"temperature": 21.53, "temperature_valid": true}}`, "temperature t1 21.5"},
+		{`{"id": "t1", "type": "temperature", "temperature": {"temperature_valid": true}}`, ""},
+		{`{"id": "ll1", "type": "light_level", "light": {"light_level": 20792, "light_level_valid": true}}`, "light_level ll1 120"},
+		{`{"id": "ll1", "type": "light_level", "light": {"light_level": 1, "light_level_valid": true}}`, "light_level ll1 1"},
+		{`{"id": "ll1", "type": "light_level", "light": {"light_level": 20792, "light_level_valid": false}}`, ""},
+	}
+	for _, z := range zs {
+		var d hue.EventData
+		if err := json.Unmarshal([]byte(z.data), &d); err != nil {
+			t.Fatal(err)
+		}
+		cout := make(chan disco.Cmd, 1)
+		watchEventData(cout, d, nil, nil, map[string]bool{})
+		close(cout)
+		var got []string
+		for c := range cout {
+			got = append(got, c.String())
+		}
+		if s := strings.Join(got, ", "); s != z.ex {
+			t.Errorf("%s: expected %q got %q", z.data, z.ex, s)
+		}
+	}
+}
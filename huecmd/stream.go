@@ -0,0 +1,363 @@
+package huecmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dedelala/disco"
+	"github.com/dedelala/disco/color"
+	"github.com/dedelala/disco/hue"
+)
+
+// Streamer renders switch, dim and color commands for the lights of an
+// entertainment area locally, including fades, and streams the result to
+// the bridge. Everything else is passed to the Cmdr, as is everything while
+// the stream can not be started.
+type Streamer struct {
+	Cmdr
+	Area string
+	Rate int
+
+	mu     *sync.Mutex
+	chans  map[string]*channel
+	stream sender
+	done   chan struct{}
+	// retry is when to try starting the stream again after it failed
+	retry time.Time
+}
+
+// sender is the part of a hue.Stream the Streamer uses.
+type sender interface {
+	Send([]hue.ChannelRGB) error
+	Close() error
+}
+
+// retryAfter is how long the Streamer passes everything to the Cmdr after the
+// stream fails to start.
+const retryAfter = 30 * time.Second
+
+func NewStreamer(c Cmdr, area string, rate int) *Streamer {
+	return &Streamer{
+		Cmdr: c,
+		Area: area,
+		Rate: min(max(rate, 25), 50),
+		mu:   &sync.Mutex{},
+	}
+}
+
+type channel struct {
+	id   uint8
+	on   bool
+	bri  float64
+	clr  color.Color
+	from [3]float64
+	at   time.Time
+	dur  time.Duration
+}
+
+func (ch *channel) target() [3]float64 {
+	if !ch.on {
+		return [3]float64{}
+	}
+	r, g, b := ch.clr.RGBf()
+	v := ch.bri / 100
+	return [3]float64{r * v, g * v, b * v}
+}
+
+func (ch *channel) output(t time.Time) [3]float64 {
+	to := ch.target()
+	if ch.dur <= 0 || t.Sub(ch.at) >= ch.dur {
+		return to
+	}
+	f := float64(t.Sub(ch.at)) / float64(ch.dur)
+	var o [3]float64
+	for i := range o {
+		o[i] = ch.from[i] + (to[i]-ch.from[i])*f
+	}
+	return o
+}
+
+func (ch *channel) copy() *channel {
+	c := *ch
+	return &c
+}
+
+// streamRequest describes the frames a channel would be streamed in a dry
+// run.
+func streamRequest(target string, ch *channel) disco.Cmd {
+	return disco.RequestCmd(target, struct {
+		Channel  uint8
+		RGB      [3]float64
+		Duration string
+	}{ch.id, ch.target(), ch.dur.String()})
+}
+
+func (ch *channel) fade(d time.Duration) {
+	now := time.Now()
+	ch.from = ch.output(now)
+	ch.at = now
+	ch.dur = d
+}
+
+// streamed reports whether the Streamer renders action. Anything else goes to
+// the bridge.
+func streamed(action string) bool {
+	return action == "switch" || action == "dim" || action == "color"
+}
+
+func (s *Streamer) Cmd(ctx context.Context, cmds []disco.Cmd) ([]disco.Cmd, error) {
+	dry := disco.IsDryRun(ctx)
+	if !dry {
+		err := s.start(ctx)
+		if err != nil {
+			// the bridge is still there without the stream
+			slog.Warn("hue stream", "area", s.Area, "error", err)
+		}
+	}
+
+	var (
+		cout   []disco.Cmd
+		errs   error
+		passed []disco.Cmd
+		getAll = map[string]bool{}
+	)
+	s.mu.Lock()
+	for _, cmd := range cmds {
+		ch, ok := s.chans[cmd.Target]
+		if cmd.Target == "" && streamed(cmd.Action) {
+			getAll[cmd.Action] = true
+		}
+		if !ok || !streamed(cmd.Action) {
+			passed = append(passed, cmd)
+			continue
+		}
+		if dry {
+			ch = ch.copy()
+		}
+		cs, err := streamCmd(cmd, ch)
+		cout = append(cout, cs...)
+		errs = errors.Join(errs, err)
+		if dry && err == nil && len(cmd.Args) > 0 {
+			cout = append(cout, streamRequest(cmd.Target, ch))
+		}
+	}
+	for action := range getAll {
+		for t, ch := range s.chans {
+			cs, _ := streamCmd(disco.Cmd{Action: action, Target: t}, ch)
+			cout = append(cout, cs...)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(passed) == 0 {
+		return cout, errs
+	}
+	cs, err := s.Cmdr.Cmd(ctx, passed)
+	s.mu.Lock()
+	for _, c := range cs {
+		// the bridge does not know what is streamed
+		if _, ok := s.chans[c.Target]; !ok || !streamed(c.Action) {
+			cout = append(cout, c)
+		}
+	}
+	s.mu.Unlock()
+	return cout, errors.Join(errs, err)
+}
+
+func streamCmd(cmd disco.Cmd, ch *channel) ([]disco.Cmd, error) {
+	switch cmd.Action {
+	case "switch":
+		if len(cmd.Args) == 0 {
+			return []disco.Cmd{disco.SwitchCmd(cmd.Target, ch.on)}, nil
+		}
+		on, err := disco.ParseSwitch(cmd.Args[0])
+		if err != nil {
+			return nil, disco.TargetErr(cmd.Target, err)
+		}
+		d, err := disco.ParseDuration(cmd.Args)
+		if err != nil {
+			return nil, disco.TargetErr(cmd.Target, err)
+		}
+		ch.fade(d)
+		ch.on = on
+	case "dim":
+		if len(cmd.Args) == 0 {
+			return []disco.Cmd{disco.DimCmd(cmd.Target, ch.bri)}, nil
+		}
+		v, err := disco.ParseDim(cmd.Args[0])
+		if err != nil {
+			return nil, disco.TargetErr(cmd.Target, err)
+		}
+		d, err := disco.ParseDuration(cmd.Args)
+		if err != nil {
+			return nil, disco.TargetErr(cmd.Target, err)
+		}
+		ch.fade(d)
+		ch.bri = v
+	case "color":
+		if len(cmd.Args) == 0 {
+			return []disco.Cmd{disco.ColorCmd(cmd.Target, ch.clr)}, nil
+		}
+		clr, err := color.Parse(cmd.Args[0])
+		if err != nil {
+			return nil, disco.TargetErr(cmd.Target, err)
+		}
+		d, err := disco.ParseDuration(cmd.Args)
+		if err != nil {
+			return nil, disco.TargetErr(cmd.Target, err)
+		}
+		ch.fade(d)
+		ch.clr = clr.Strip()
+	}
+	return nil, nil
+}
+
+func (s *Streamer) start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stream != nil || time.Now().Before(s.retry) {
+		return nil
+	}
+	err := s.open(ctx)
+	if err != nil {
+		s.retry = time.Now().Add(retryAfter)
+	}
+	return err
+}
+
+// open reads the area and starts the stream. The caller holds the lock.
+func (s *Streamer) open(ctx context.Context) error {
+
+	ec, err := s.EntertainmentConfiguration(ctx, s.Area)
+	if err != nil {
+		return err
+	}
+	es, err := s.Entertainments(ctx)
+	if err != nil {
+		return err
+	}
+	ls, err := s.Lights(ctx)
+	if err != nil {
+		return err
+	}
+
+	renderers := map[string]string{}
+	for _, e := range es {
+		if e.RendererReference != nil {
+			renderers[e.Id] = e.RendererReference.Rid
+		}
+	}
+	lm := map[string]hue.Light{}
+	for _, l := range ls {
+		lm[l.Id] = l
+	}
+	segments := map[string]int{}
+	for _, c := range ec.Channels {
+		for _, m := range c.Members {
+			segments[m.Service.Rid]++
+		}
+	}
+
+	chans := map[string]*channel{}
+	for _, c := range ec.Channels {
+		if len(c.Members) == 0 {
+			continue
+		}
+		m := c.Members[0]
+		id, ok := renderers[m.Service.Rid]
+		if !ok {
+			continue
+		}
+		target := id
+		if segments[m.Service.Rid] > 1 {
+			target = fmt.Sprintf("%s/%d", id, m.Index)
+		}
+		ch := &channel{id: c.ChannelId, on: true, bri: 100, clr: 0xffffff}
+		if l, ok := lm[id]; ok {
+			ch.on = l.On.On
+			if l.Dimming != nil {
+				ch.bri = l.Dimming.Brightness
+			}
+			if l.Color != nil {
+				ch.clr = color.XYBfPhilipsWideRGBD65(l.Color.XY.X, l.Color.XY.Y, 1.0)
+			}
+		}
+		ch.from = ch.target()
+		chans[target] = ch
+	}
+
+	stream, err := s.Stream(ctx, s.Area)
+	if err != nil {
+		return err
+	}
+	s.chans = chans
+	s.stream = stream
+	s.done = make(chan struct{})
+	go s.render(stream, s.done)
+	return nil
+}
+
+func (s *Streamer) render(stream sender, done <-chan struct{}) {
+	t := time.NewTicker(time.Second / time.Duration(s.Rate))
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-t.C:
+			s.mu.Lock()
+			frame := make([]hue.ChannelRGB, 0, len(s.chans))
+			for _, ch := range s.chans {
+				o := ch.output(now)
+				frame = append(frame, hue.ChannelRGB{
+					Channel: ch.id,
+					R:       uint16(o[0] * math.MaxUint16),
+					G:       uint16(o[1] * math.MaxUint16),
+					B:       uint16(o[2] * math.MaxUint16),
+				})
+			}
+			s.mu.Unlock()
+			err := stream.Send(frame)
+			if err != nil {
+				slog.Warn("hue stream", "error", err)
+				s.reset(stream)
+				return
+			}
+		}
+	}
+}
+
+// reset drops a stream that failed, so the next command starts it again.
+// Until then, everything is passed to the Cmdr.
+func (s *Streamer) reset(stream sender) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stream != stream {
+		return
+	}
+	err := stream.Close()
+	if err != nil {
+		slog.Warn("hue stream close", "error", err)
+	}
+	s.stream, s.chans, s.done = nil, nil, nil
+}
+
+// Close stops rendering and ends the stream.
+func (s *Streamer) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stream == nil {
+		return
+	}
+	close(s.done)
+	err := s.stream.Close()
+	if err != nil {
+		slog.Warn("hue stream close", "error", err)
+	}
+	s.stream = nil
+}
@@ -0,0 +1,155 @@
+package huecmd
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dedelala/disco"
+	"github.com/dedelala/disco/hue"
+)
+
+// failSender is a stream that can not be sent to.
+type failSender struct{}
+
+func (failSender) Send([]hue.ChannelRGB) error { return errors.New("dtls: closed") }
+func (failSender) Close() error                { return nil }
+
+func TestStreamer(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		puts []string
+	)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPut {
+			mu.Lock()
+			puts = append(puts, req.URL.Path)
+			mu.Unlock()
+		}
+		if strings.HasSuffix(req.URL.Path, "zigbee_connectivity") {
+			w.Write([]byte(`{"data": [{"id": "z1", "owner": {"rid": "d1"}, "status": "connected"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data": [
+			{"id": "l1", "owner": {"rid": "d1", "rtype": "device"}, "on": {"on": true},
+				"color": {"xy": {"x": 0.3, "y": 0.3}}, "gradient": {"points": [], "points_capable": 5}},
+			{"id": "l2", "owner": {"rid": "d2", "rtype": "device"}, "on": {"on": true}}
+		]}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	var (
+		ctx = context.Background()
+		s   = NewStreamer(Cmdr{Client: hue.New(hue.Config{Host: u.Host})}, "area", 50)
+		ch  = &channel{id: 1, on: true, bri: 100, clr: 0xffffff}
+		run = func(c string) []disco.Cmd {
+			t.Helper()
+			cs, err := s.Cmd(ctx, []disco.Cmd{disco.ParseCmdString(c)})
+			if err != nil {
+				t.Fatalf("%s: %s", c, err)
+			}
+			return cs
+		}
+	)
+	ch.from = ch.target()
+	// already streaming, with l1 in the area
+	s.stream, s.chans = &hue.Stream{}, map[string]*channel{"l1": ch}
+
+	near := func(o [3]float64, v float64) bool {
+		return math.Abs(o[0]-v) < 1e-9 && o[0] == o[1] && o[1] == o[2]
+	}
+	run("dim l1 50 2s")
+	var zs = []struct {
+		after time.Duration
+		v     float64
+	}{
+		{0, 1.0},
+		{time.Second, 0.75},
+		{2 * time.Second, 0.5},
+		{time.Minute, 0.5},
+	}
+	for _, z := range zs {
+		if o := ch.output(ch.at.Add(z.after)); !near(o, z.v) {
+			t.Errorf("dim fade after %s: expected %f got %v", z.after, z.v, o)
+		}
+	}
+	run("color l1 ff0000 0s")
+	if o := ch.output(time.Now()); o != [3]float64{0.5, 0, 0} {
+		t.Errorf("expected half red got %v", o)
+	}
+	run("switch l1 off 2s")
+	if o := ch.output(ch.at.Add(time.Second)); o != [3]float64{0.25, 0, 0} {
+		t.Errorf("expected a quarter red half way through switching off got %v", o)
+	}
+	if o := ch.output(ch.at.Add(2 * time.Second)); o != [3]float64{} {
+		t.Errorf("expected black got %v", o)
+	}
+
+	var got []string
+	for _, c := range run("switch") {
+		got = append(got, c.String())
+	}
+	slices.Sort(got)
+	if ex := []string{"switch l1 off", "switch l2 on"}; !slices.Equal(got, ex) {
+		t.Errorf("expected %q got %q", ex, got)
+	}
+	if cs := run("dim l1"); len(cs) != 1 || cs[0].String() != "dim l1 50" {
+		t.Errorf("expected dim l1 50 got %v", cs)
+	}
+	if cs := run("status l1"); len(cs) != 1 || cs[0].String() != "status l1 reachable" {
+		t.Errorf("expected status from the bridge got %v", cs)
+	}
+	lastPut := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(puts) == 0 {
+			return ""
+		}
+		p := puts[len(puts)-1]
+		puts = nil
+		return p
+	}
+	if p := lastPut(); p != "" {
+		t.Errorf("expected everything so far rendered locally got %q", p)
+	}
+	run("gradient l1 ff0000 0000ff")
+	if p := lastPut(); !strings.HasSuffix(p, "/light/l1") {
+		t.Errorf("expected gradient passed to the bridge got %q", p)
+	}
+
+	// the stream drops, so commands go to the bridge until it starts again
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.stream, s.done = failSender{}, done
+	s.mu.Unlock()
+	go s.render(failSender{}, done)
+	for i := 0; ; i++ {
+		s.mu.Lock()
+		reset := s.stream == nil && s.chans == nil
+		s.mu.Unlock()
+		if reset {
+			break
+		}
+		if i > 1000 {
+			t.Fatal("expected the stream reset after a send failed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// the area is not a resource id, so it does not start
+	run("switch l1 on")
+	if p := lastPut(); !strings.HasSuffix(p, "/light/l1") {
+		t.Errorf("expected switch passed to the bridge got %q", p)
+	}
+	if !s.retry.After(time.Now()) {
+		t.Error("expected a retry later")
+	}
+}
@@ -94,6 +94,12 @@ type State struct {
 	Power  uint16
 	Color
 	*Product
+	// Reappeared is set by Watch when the target had not been heard from
+	// for a while, like after losing power.
+	Reappeared bool
+	// Lost is set by Watch when the target has not been heard from for a
+	// while. The rest of the state is the last one heard.
+	Lost bool
 }
 
 type Color struct {
@@ -116,12 +122,13 @@ func newState(target uint64, sp *statePayload) State {
 	}
 }
 
-func (l *Client) State(target ...uint64) ([]State, error) {
-	<-l.ready
-
-	discos := <-l.discos
+func (l *Client) State(ctx context.Context, target ...uint64) ([]State, error) {
+	discos, err := l.discovered(ctx)
+	if err != nil {
+		return nil, err
+	}
 	if len(target) == 0 {
-		return l.state(discos)
+		return l.state(ctx, discos)
 	}
 	targetDiscos := map[uint64]discovery{}
 	var errs error
@@ -133,16 +140,44 @@ func (l *Client) State(target ...uint64) ([]State, error) {
 		}
 		targetDiscos[t] = d
 	}
-	ss, err := l.state(targetDiscos)
+	ss, err := l.state(ctx, targetDiscos)
 	for i := range ss {
 		ss[i].Product = discos[ss[i].Target].product
 	}
 	return ss, errors.Join(errs, err)
 }
 
-func (l *Client) state(discos map[uint64]discovery) ([]State, error) {
-	<-l.ready
+// Known returns the state each target last reported, or every device's if no
+// target is given, without asking them. Devices that have not reported their
+// state since discovery are left out.
+func (l *Client) Known(ctx context.Context, target ...uint64) ([]State, error) {
+	discos, err := l.discovered(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(target) == 0 {
+		for t := range discos {
+			target = append(target, t)
+		}
+	}
+	var (
+		ss   []State
+		errs error
+	)
+	for _, t := range target {
+		d, ok := discos[t]
+		if !ok || d.state == nil {
+			errs = errors.Join(errs, fmt.Errorf("%x: light not found or not reachable", t))
+			continue
+		}
+		s := newState(t, d.state)
+		s.Product = d.product
+		ss = append(ss, s)
+	}
+	return ss, errs
+}
 
+func (l *Client) state(ctx context.Context, discos map[uint64]discovery) ([]State, error) {
 	var (
 		states = make(chan State)
 		errs   = make(chan error)
@@ -151,7 +186,7 @@ func (l *Client) state(discos map[uint64]discovery) ([]State, error) {
 	for id, d := range discos {
 		wg.Add(1)
 		go func() {
-			s, err := l.get(d.addr)
+			s, err := l.get(ctx, d.addr)
 			if err != nil {
 				errs <- err
 			}
@@ -190,13 +225,15 @@ func (l *Client) state(discos map[uint64]discovery) ([]State, error) {
 }
 
 type SetPower struct {
-	Level uint16
+	Level    uint16
+	Duration uint32
 }
 
-func (l *Client) SetPower(target uint64, s SetPower) error {
-	<-l.ready
-
-	discos := <-l.discos
+func (l *Client) SetPower(ctx context.Context, target uint64, s SetPower) error {
+	discos, err := l.discovered(ctx)
+	if err != nil {
+		return err
+	}
 	d, ok := discos[target]
 	if !ok {
 		return errors.New("light not found")
@@ -207,10 +244,14 @@ func (l *Client) SetPower(target uint64, s SetPower) error {
 		},
 		addr: d.addr,
 		payload: &setPowerPayload{
-			level: s.Level,
+			level:    s.Level,
+			duration: s.Duration,
 		},
 	}
-	if !l.txAck(p) {
+	if !l.txAck(ctx, p) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return errors.New("did not ack")
 	}
 	return nil
@@ -221,10 +262,11 @@ type SetColor struct {
 	Duration uint32
 }
 
-func (l *Client) SetColor(target uint64, s SetColor) error {
-	<-l.ready
-
-	discos := <-l.discos
+func (l *Client) SetColor(ctx context.Context, target uint64, s SetColor) error {
+	discos, err := l.discovered(ctx)
+	if err != nil {
+		return err
+	}
 	d, ok := discos[target]
 	if !ok {
 		return errors.New("light not found")
@@ -242,12 +284,66 @@ func (l *Client) SetColor(target uint64, s SetColor) error {
 			duration: s.Duration,
 		},
 	}
-	if !l.txAck(p) {
+	if !l.txAck(ctx, p) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return errors.New("did not ack")
 	}
 	return nil
 }
 
+// discoverEvery is the most discovery waits between asking for devices.
+const discoverEvery = 60 * time.Second
+
+// lostAfter is how long Watch goes without hearing from a device, which it
+// asks every second, before it is taken to have gone away.
+const lostAfter = 5 * time.Second
+
+// staleAfter is how long a device discovered is not heard from before it is
+// unreachable. A device that answers discovery is heard from at least every
+// discoverEvery, so it has two chances.
+const staleAfter = 2*discoverEvery + time.Second
+
+// reachable reports whether a device last heard from at last is still
+// reachable at now, if it is heard from within d.
+func reachable(last, now time.Time, d time.Duration) bool {
+	return !last.IsZero() && now.Sub(last) <= d
+}
+
+// reach tracks when devices were last heard from, and which are lost for not
+// being heard from within after.
+type reach struct {
+	after time.Duration
+	seen  map[uint64]time.Time
+	lost  map[uint64]bool
+}
+
+func newReach(after time.Duration) *reach {
+	return &reach{after: after, seen: map[uint64]time.Time{}, lost: map[uint64]bool{}}
+}
+
+// heard records hearing from id at now, and reports whether it was lost.
+func (r *reach) heard(id uint64, now time.Time) (back bool) {
+	back = r.lost[id]
+	r.seen[id] = now
+	delete(r.lost, id)
+	return back
+}
+
+// check returns the devices lost since the last check.
+func (r *reach) check(now time.Time) []uint64 {
+	var ids []uint64
+	for id, last := range r.seen {
+		if r.lost[id] || reachable(last, now, r.after) {
+			continue
+		}
+		r.lost[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 func (l *Client) Watch(ctx context.Context) (<-chan State, error) {
 	addrs, err := ip4BroadcastAddrs()
 	if err != nil {
@@ -281,12 +377,21 @@ func (l *Client) Watch(ctx context.Context) (<-chan State, error) {
 	go func() {
 		rx := l.rp()
 		sm := map[uint64]State{}
+		r := newReach(lostAfter)
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				close(rx.done)
 				close(sout)
 				return
+			case now := <-t.C:
+				for _, id := range r.check(now) {
+					s := sm[id]
+					s.Lost = true
+					sout <- s
+				}
 			case p := <-rx.c:
 				if p.ptype != liState {
 					continue
@@ -296,8 +401,10 @@ func (l *Client) Watch(ctx context.Context) (<-chan State, error) {
 					continue
 				}
 				s := newState(p.target, sp)
-				if sm[s.Target] != s {
+				back := r.heard(s.Target, time.Now())
+				if sm[s.Target] != s || back {
 					sm[s.Target] = s
+					s.Reappeared = back
 					sout <- s
 				}
 			}
@@ -352,7 +459,7 @@ func (l *Client) rx() (*packet, error) {
 	return pkt, nil
 }
 
-func (l *Client) txAck(p *packet) (ok bool) {
+func (l *Client) txAck(ctx context.Context, p *packet) (ok bool) {
 	p.ack = true
 	var (
 		dly = backoff(1, 100)
@@ -365,6 +472,8 @@ func (l *Client) txAck(p *packet) (ok bool) {
 		select {
 		case <-to:
 			return false
+		case <-ctx.Done():
+			return false
 		case <-tc:
 			tc = after(dly())
 			l.tx(p)
@@ -380,7 +489,7 @@ func (l *Client) txAck(p *packet) (ok bool) {
 	}
 }
 
-func (l *Client) txRes(p *packet) (r *packet, ok bool) {
+func (l *Client) txRes(ctx context.Context, p *packet) (r *packet, ok bool) {
 	p.res = true
 	var (
 		dly = backoff(1, 100)
@@ -393,6 +502,8 @@ func (l *Client) txRes(p *packet) (r *packet, ok bool) {
 		select {
 		case <-to:
 			return nil, false
+		case <-ctx.Done():
+			return nil, false
 		case <-tc:
 			tc = after(dly())
 			l.tx(p)
@@ -410,7 +521,7 @@ func (l *Client) txRes(p *packet) (r *packet, ok bool) {
 
 func (l *Client) discoverTx(addrs []net.Addr) {
 	var (
-		dly = backoff(1, 60000)
+		dly = backoff(1, int(discoverEvery/time.Millisecond))
 		t   = after(0)
 	)
 	for {
@@ -431,6 +542,13 @@ func (l *Client) discoverTx(addrs []net.Addr) {
 					},
 					addr: addr,
 				})
+				l.tx(&packet{
+					header: header{
+						tagged: true,
+						ptype:  liGet,
+					},
+					addr: addr,
+				})
 			}
 			t = after(dly())
 		case <-l.done:
@@ -442,10 +560,13 @@ func (l *Client) discoverTx(addrs []net.Addr) {
 type discovery struct {
 	addr    *net.UDPAddr
 	product *Product
+	seen    time.Time
+	// state is the last state heard, in answer to anything
+	state *statePayload
 }
 
 func (d discovery) ready() bool {
-	return d.addr != nil && d.product != nil
+	return d.addr != nil && d.product != nil && d.state != nil
 }
 
 func (l *Client) discoverRx(rx <-chan *packet) {
@@ -462,9 +583,14 @@ func (l *Client) discoverRx(rx <-chan *packet) {
 				return
 			}
 
+			if d, ok := discos[p.target]; ok {
+				d.seen = time.Now()
+				discos[p.target] = d
+			}
 			switch p.ptype {
 			case devStateService:
 			case devStateVersion:
+			case liState:
 			default:
 				continue
 			}
@@ -476,6 +602,7 @@ func (l *Client) discoverRx(rx <-chan *packet) {
 			}
 
 			d := discos[p.target]
+			d.seen = time.Now()
 			switch p.ptype {
 			case devStateService:
 				pld, ok := p.payload.(*servicePayload)
@@ -497,6 +624,13 @@ func (l *Client) discoverRx(rx <-chan *packet) {
 					continue
 				}
 				d.product = products[pld.product]
+			case liState:
+				pld, ok := p.payload.(*statePayload)
+				if !ok || pld == nil {
+					slog.Warn("lifx discover: bad state payload")
+					continue
+				}
+				d.state = pld
 			}
 			discos[p.target] = d
 			if len(discos) >= l.Config.Devices && !ready {
@@ -527,6 +661,36 @@ func (l *Client) discoverRx(rx <-chan *packet) {
 	}
 }
 
+// discovered waits for discovery to be ready and returns the devices found.
+func (l *Client) discovered(ctx context.Context) (map[uint64]discovery, error) {
+	select {
+	case <-l.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case discos := <-l.discos:
+		return discos, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Reachable returns whether each device discovered has been heard from since
+// discovery last asked, or the time before.
+func (l *Client) Reachable(ctx context.Context) (map[uint64]bool, error) {
+	discos, err := l.discovered(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	rs := make(map[uint64]bool, len(discos))
+	for id, d := range discos {
+		rs[id] = reachable(d.seen, now, staleAfter)
+	}
+	return rs, nil
+}
+
 func (l *Client) addr(dev string) (*net.UDPAddr, error) {
 	var id uint64
 	n, err := fmt.Sscanf(dev, "%x", &id)
@@ -548,7 +712,7 @@ func (l *Client) addr(dev string) (*net.UDPAddr, error) {
 	return d.addr, nil
 }
 
-func (l *Client) get(addr net.Addr) (*statePayload, error) {
+func (l *Client) get(ctx context.Context, addr net.Addr) (*statePayload, error) {
 	p := &packet{
 		header: header{
 			ptype: liGet,
@@ -556,7 +720,10 @@ func (l *Client) get(addr net.Addr) (*statePayload, error) {
 		addr: addr,
 	}
 
-	r, ok := l.txRes(p)
+	r, ok := l.txRes(ctx, p)
+	if !ok && ctx.Err() != nil {
+		return nil, fmt.Errorf("lifx get %s: %w", addr, ctx.Err())
+	}
 	if !ok {
 		return nil, fmt.Errorf("lifx get %s: no response", addr)
 	}
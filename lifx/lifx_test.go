@@ -2,7 +2,10 @@ package lifx
 
 import (
 	"bytes"
+	"context"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestHeader(t *testing.T) {
@@ -33,3 +36,87 @@ func TestHeader(t *testing.T) {
 		t.Errorf("expected\n  %#+v\ngot\n  %#+v", ex, b)
 	}
 }
+
+func TestReachable(t *testing.T) {
+	t0 := time.Now()
+	// discovery backs off, so a device answers less often over time
+	for _, d := range []time.Duration{time.Second, 30 * time.Second, discoverEvery, 2 * discoverEvery} {
+		if !reachable(t0, t0.Add(d), staleAfter) {
+			t.Errorf("%s: expected reachable", d)
+		}
+	}
+	if reachable(t0, t0.Add(staleAfter+time.Second), staleAfter) {
+		t.Error("expected unreachable after two discoveries")
+	}
+	if reachable(time.Time{}, t0, staleAfter) {
+		t.Error("expected unreachable if never heard from")
+	}
+}
+
+func TestReach(t *testing.T) {
+	var (
+		r  = newReach(lostAfter)
+		t0 = time.Now()
+	)
+	r.heard(1, t0)
+	if lost := r.check(t0.Add(time.Second)); len(lost) != 0 {
+		t.Errorf("expected nothing lost got %v", lost)
+	}
+	if r.heard(1, t0.Add(time.Second)) {
+		t.Error("expected not back, it was never lost")
+	}
+	// power cycled at the wall for a few seconds
+	if lost := r.check(t0.Add(lostAfter + 2*time.Second)); len(lost) != 1 || lost[0] != 1 {
+		t.Errorf("expected 1 lost got %v", lost)
+	}
+	if lost := r.check(t0.Add(lostAfter + 3*time.Second)); len(lost) != 0 {
+		t.Errorf("expected lost once got %v", lost)
+	}
+	if !r.heard(1, t0.Add(20*time.Second)) {
+		t.Error("expected back")
+	}
+	if r.heard(1, t0.Add(21*time.Second)) {
+		t.Error("expected back once")
+	}
+}
+
+func TestKnown(t *testing.T) {
+	var pid uint32
+	for k := range products {
+		pid = k
+		break
+	}
+	l := &Client{
+		Config: Config{Timeout: 10000, Devices: 1},
+		discos: make(chan map[uint64]discovery),
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	defer close(l.done)
+	rx := make(chan *packet)
+	go l.discoverRx(rx)
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 56700}
+	for _, p := range []*packet{
+		{header: header{target: 1, ptype: devStateService}, addr: addr, payload: &servicePayload{port: 56700}},
+		{header: header{target: 1, ptype: devStateVersion}, addr: addr, payload: &versionPayload{product: pid}},
+	} {
+		rx <- p
+	}
+	select {
+	case <-l.ready:
+		t.Fatal("expected not ready before the state is heard")
+	default:
+	}
+	rx <- &packet{header: header{target: 1, ptype: liState}, addr: addr, payload: &statePayload{b: 1000, power: 65535}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ss, err := l.Known(ctx, 1)
+	if err != nil || len(ss) != 1 || ss[0].B != 1000 || ss[0].Power != 65535 || ss[0].Product == nil {
+		t.Errorf("expected the state heard got %+v %v", ss, err)
+	}
+	if _, err := l.Known(ctx, 2); err == nil {
+		t.Error("expected an error for a light not heard from")
+	}
+}
@@ -319,6 +319,7 @@ type setPowerPayload struct {
 func (p *setPowerPayload) marshal() ([]byte, error) {
 	var vs = []interface{}{
 		p.level,
+		p.duration,
 	}
 	return binwrite(vs)
 }
@@ -326,6 +327,7 @@ func (p *setPowerPayload) marshal() ([]byte, error) {
 func (p *setPowerPayload) unmarshal(b []byte) error {
 	var vs = []interface{}{
 		&p.level,
+		&p.duration,
 	}
 	return binread(b, vs)
 }
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"log/slog"
 	"math"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/dedelala/disco"
 	"github.com/dedelala/disco/color"
@@ -17,7 +19,66 @@ type Cmdr struct {
 	*lifx.Client
 }
 
-func (c Cmdr) Cmd(cmds []disco.Cmd) ([]disco.Cmd, error) {
+func (c Cmdr) Cmd(ctx context.Context, cmds []disco.Cmd) ([]disco.Cmd, error) {
+	var gets []disco.Cmd
+	cmds = slices.DeleteFunc(slices.Clone(cmds), func(cmd disco.Cmd) bool {
+		if cmd.Action == "status" {
+			gets = append(gets, cmd)
+			return true
+		}
+		return false
+	})
+	if len(gets) == 0 {
+		return c.cmd(ctx, cmds)
+	}
+	cout, err := c.status(ctx, gets)
+	if len(cmds) == 0 {
+		return cout, err
+	}
+	cs, cerr := c.cmd(ctx, cmds)
+	return append(cout, cs...), errors.Join(err, cerr)
+}
+
+// status reports the devices discovered as reachable if they have been heard
+// from recently.
+func (c Cmdr) status(ctx context.Context, cmds []disco.Cmd) ([]disco.Cmd, error) {
+	rs, err := c.Reachable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		targets []uint64
+		errs    error
+	)
+	for _, cmd := range cmds {
+		if cmd.Target == "" {
+			targets = targets[:0]
+			for t := range rs {
+				targets = append(targets, t)
+			}
+			slices.Sort(targets)
+			break
+		}
+		t, err := parseTarget(cmd.Target)
+		if err != nil {
+			errs = errors.Join(errs, disco.TargetErr(cmd.Target, err))
+			continue
+		}
+		if _, ok := rs[t]; !ok {
+			errs = errors.Join(errs, disco.TargetErr(cmd.Target, disco.ErrNotFound))
+			continue
+		}
+		targets = append(targets, t)
+	}
+
+	var cout []disco.Cmd
+	for _, t := range targets {
+		cout = append(cout, disco.StatusCmd(fmt.Sprintf("%x", t), rs[t]))
+	}
+	return cout, errs
+}
+
+func (c Cmdr) cmd(ctx context.Context, cmds []disco.Cmd) ([]disco.Cmd, error) {
 	var (
 		cout  []disco.Cmd
 		errs  error
@@ -25,7 +86,7 @@ func (c Cmdr) Cmd(cmds []disco.Cmd) ([]disco.Cmd, error) {
 		creqs = map[string]lifx.SetColor{}
 	)
 
-	states, err := c.states(cmds)
+	states, err := c.states(ctx, cmds)
 	if len(states) == 0 {
 		return nil, err
 	}
@@ -36,6 +97,10 @@ func (c Cmdr) Cmd(cmds []disco.Cmd) ([]disco.Cmd, error) {
 			cs  []disco.Cmd
 			err error
 		)
+		if _, ok := states[cmd.Target]; !ok && cmd.Target != "" {
+			// already reported by states
+			continue
+		}
 		switch cmd.Action {
 		case "switch":
 			cs, err = cmdSwitch(cmd, states, preqs)
@@ -48,13 +113,29 @@ func (c Cmdr) Cmd(cmds []disco.Cmd) ([]disco.Cmd, error) {
 		errs = errors.Join(errs, err)
 	}
 
-	wg := &sync.WaitGroup{}
+	if disco.IsDryRun(ctx) {
+		for t, r := range preqs {
+			cout = append(cout, disco.RequestCmd(t, r))
+		}
+		for t, r := range creqs {
+			cout = append(cout, disco.RequestCmd(t, r))
+		}
+		return cout, errs
+	}
+
+	var (
+		wg = &sync.WaitGroup{}
+		mu = &sync.Mutex{}
+	)
 	for t, r := range preqs {
 		wg.Add(1)
 		go func() {
-			err := c.SetPower(states[t].Target, r)
+			err := c.SetPower(ctx, states[t].Target, r)
 			if err != nil {
 				slog.Warn("lifx did not ack", "target", t)
+				mu.Lock()
+				errs = errors.Join(errs, disco.TargetErr(t, unreachable(err)))
+				mu.Unlock()
 			}
 			wg.Done()
 		}()
@@ -65,19 +146,22 @@ func (c Cmdr) Cmd(cmds []disco.Cmd) ([]disco.Cmd, error) {
 	for t, r := range creqs {
 		wg.Add(1)
 		go func() {
-			err := c.SetColor(states[t].Target, r)
+			err := c.SetColor(ctx, states[t].Target, r)
 			if err != nil {
 				slog.Warn("lifx did not ack", "target", t)
+				mu.Lock()
+				errs = errors.Join(errs, disco.TargetErr(t, unreachable(err)))
+				mu.Unlock()
 			}
 			wg.Done()
 		}()
 	}
 	wg.Wait()
 
-	return cout, nil
+	return cout, errs
 }
 
-func (c Cmdr) states(cmds []disco.Cmd) (map[string]lifx.State, error) {
+func (c Cmdr) states(ctx context.Context, cmds []disco.Cmd) (map[string]lifx.State, error) {
 	var (
 		targets []uint64
 		errs    error
@@ -89,7 +173,7 @@ func (c Cmdr) states(cmds []disco.Cmd) (map[string]lifx.State, error) {
 		}
 		t, err := parseTarget(cmd.Target)
 		if err != nil {
-			errs = errors.Join(errs, fmt.Errorf("lifx: %s: %w", cmd.Target, err))
+			errs = errors.Join(errs, disco.TargetErr(cmd.Target, err))
 			continue
 		}
 		targets = append(targets, t)
@@ -98,13 +182,24 @@ func (c Cmdr) states(cmds []disco.Cmd) (map[string]lifx.State, error) {
 		return nil, errs
 	}
 
-	ss, err := c.State(targets...)
+	get := c.State
+	if disco.IsDryRun(ctx) {
+		// a dry run sends nothing, so answer from what the lights last said
+		get = c.Known
+	}
+	ss, err := get(ctx, targets...)
 	states := map[string]lifx.State{}
 	for _, s := range ss {
 		states[fmt.Sprintf("%x", s.Target)] = s
 	}
-	if err != nil {
-		errs = errors.Join(errs, fmt.Errorf("lifx: %w", err))
+	if len(targets) == 0 {
+		return states, errors.Join(errs, err)
+	}
+	for _, t := range targets {
+		target := fmt.Sprintf("%x", t)
+		if _, ok := states[target]; !ok {
+			errs = errors.Join(errs, disco.TargetErr(target, fmt.Errorf("%w: not found or not reachable", disco.ErrUnreachable)))
+		}
 	}
 	return states, errs
 }
@@ -119,21 +214,34 @@ func cmdSwitch(cmd disco.Cmd, states map[string]lifx.State, preqs map[string]lif
 	}
 	s, ok := states[cmd.Target]
 	if !ok {
-		return nil, fmt.Errorf("lifx: has no target %s", cmd.Target)
+		return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
 	}
 	if len(cmd.Args) == 0 {
 		return []disco.Cmd{disco.SwitchCmd(cmd.Target, s.Power != 0)}, nil
 	}
 	on, err := disco.ParseSwitch(cmd.Args[0])
 	if err != nil {
-		return nil, fmt.Errorf("lifx: %s: %w", cmd.Target, err)
+		return nil, disco.TargetErr(cmd.Target, err)
+	}
+	var d time.Duration
+	if len(cmd.Args) > 1 {
+		d, err = disco.ParseDuration(cmd.Args)
+		if err != nil {
+			return nil, disco.TargetErr(cmd.Target, err)
+		}
 	}
 	preqs[cmd.Target] = lifx.SetPower{
-		Level: map[bool]uint16{true: math.MaxUint16}[on],
+		Level:    map[bool]uint16{true: math.MaxUint16}[on],
+		Duration: uint32(min(max(0, d.Milliseconds()), math.MaxUint32)),
 	}
 	return nil, nil
 }
 
+// FadesSwitch is true, lifx fades the power itself.
+func (c Cmdr) FadesSwitch() bool {
+	return true
+}
+
 func cmdDim(cmd disco.Cmd, states map[string]lifx.State, creqs map[string]lifx.SetColor) ([]disco.Cmd, error) {
 	if cmd.Target == "" {
 		var cout []disco.Cmd
@@ -144,7 +252,7 @@ func cmdDim(cmd disco.Cmd, states map[string]lifx.State, creqs map[string]lifx.S
 	}
 	s, ok := states[cmd.Target]
 	if !ok {
-		return nil, fmt.Errorf("lifx: has no target %s", cmd.Target)
+		return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
 	}
 	if len(cmd.Args) == 0 {
 		return []disco.Cmd{disco.DimCmd(cmd.Target, 100*float64(s.B)/math.MaxUint16)}, nil
@@ -152,18 +260,18 @@ func cmdDim(cmd disco.Cmd, states map[string]lifx.State, creqs map[string]lifx.S
 
 	v, err := disco.ParseDim(cmd.Args[0])
 	if err != nil {
-		return nil, fmt.Errorf("lifx: %s: %w", cmd.Target, err)
+		return nil, disco.TargetErr(cmd.Target, err)
 	}
 
 	d, err := disco.ParseDuration(cmd.Args)
 	if err != nil {
-		return nil, fmt.Errorf("hue: %s: %w", cmd.Target, err)
+		return nil, disco.TargetErr(cmd.Target, err)
 	}
 	dms := uint32(min(max(0, d.Milliseconds()), math.MaxUint32))
 
 	r, ok := creqs[cmd.Target]
 	if ok && r.Duration != dms {
-		return nil, fmt.Errorf("lifx: %s: commands have conflicting durations", cmd.Target)
+		return nil, disco.TargetErr(cmd.Target, errors.New("commands have conflicting durations"))
 	}
 	if !ok {
 		r = lifx.SetColor{
@@ -191,7 +299,7 @@ func cmdColor(cmd disco.Cmd, states map[string]lifx.State, creqs map[string]lifx
 	}
 	s, ok := states[cmd.Target]
 	if !ok {
-		return nil, fmt.Errorf("lifx: has no target %s", cmd.Target)
+		return nil, disco.TargetErr(cmd.Target, disco.ErrNotFound)
 	}
 	if len(cmd.Args) == 0 {
 		clr := color.HSVf(
@@ -204,18 +312,18 @@ func cmdColor(cmd disco.Cmd, states map[string]lifx.State, creqs map[string]lifx
 
 	clr, err := color.Parse(cmd.Args[0])
 	if err != nil {
-		return nil, fmt.Errorf("lifx: %s: %w", cmd.Target, err)
+		return nil, disco.TargetErr(cmd.Target, err)
 	}
 
 	d, err := disco.ParseDuration(cmd.Args)
 	if err != nil {
-		return nil, fmt.Errorf("hue: %s: %w", cmd.Target, err)
+		return nil, disco.TargetErr(cmd.Target, err)
 	}
 	dms := uint32(min(max(0, d.Milliseconds()), math.MaxUint32))
 
 	r, ok := creqs[cmd.Target]
 	if ok && r.Duration != dms {
-		return nil, fmt.Errorf("lifx: %s: commands have conflicting durations", cmd.Target)
+		return nil, disco.TargetErr(cmd.Target, errors.New("commands have conflicting durations"))
 	}
 	if !ok {
 		r = lifx.SetColor{
@@ -241,6 +349,15 @@ func cmdColor(cmd disco.Cmd, states map[string]lifx.State, creqs map[string]lifx
 	return nil, nil
 }
 
+// unreachable marks errors from a device that did not respond, a cancelled
+// context is left as is.
+func unreachable(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", disco.ErrUnreachable, err)
+}
+
 func parseTarget(s string) (target uint64, err error) {
 	n, err := fmt.Sscanf(s, "%x", &target)
 	if err != nil {
@@ -268,6 +385,13 @@ func (c Cmdr) Watch(ctx context.Context) (<-chan disco.Cmd, error) {
 				continue
 			}
 			target := fmt.Sprintf("%x", n.Target)
+			if n.Lost {
+				cout <- disco.StatusCmd(target, false)
+				continue
+			}
+			if n.Reappeared {
+				cout <- disco.StatusCmd(target, true)
+			}
 			if n.Power != p.Power {
 				cout <- disco.SwitchCmd(target, n.Power != 0)
 			}
@@ -0,0 +1,268 @@
+package disco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+)
+
+// Master scales every dim by a grand master level, and by the submaster level
+// of each link the target is in, like the masters of a lighting desk. The
+// levels are set with the master and sub commands, handled by Masters before
+// links are expanded.
+//
+// Dim getters answer with the level before scaling.
+type Master struct {
+	Cmdr
+	Linker Linker
+
+	mu *sync.Mutex
+	st *masterState
+}
+
+type masterState struct {
+	grand float64
+	subs  map[string]float64
+	// level is the dim of each target before scaling
+	level map[string]float64
+}
+
+func WithMaster(c Cmdr, links map[string][]string) Master {
+	return Master{
+		Cmdr:   c,
+		Linker: WithLink(nil, links),
+		mu:     &sync.Mutex{},
+		st: &masterState{
+			grand: 100,
+			subs:  map[string]float64{},
+			level: map[string]float64{},
+		},
+	}
+}
+
+func MasterCmd(v float64) Cmd {
+	return newCmd("master", fmt.Sprintf("%.f", v))
+}
+
+func SubCmd(link string, v float64) Cmd {
+	return newCmd("sub", link, fmt.Sprintf("%.f", v))
+}
+
+// Masters gets and sets the levels of a Master, which sets the dim of the
+// targets it scales again at the new scale. A submaster is bound to a link,
+// so Masters goes before the link is expanded.
+//
+//	master [level] [duration]
+//	sub <link> [level] [duration]
+type Masters struct {
+	Cmdr
+	Master Master
+}
+
+func WithMasters(c Cmdr, m Master) Masters {
+	return Masters{c, m}
+}
+
+func (m Masters) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var (
+		cout    []Cmd
+		errs    error
+		pending []Cmd
+	)
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		cs, err := m.Cmdr.Cmd(ctx, pending)
+		cout = append(cout, cs...)
+		errs = errors.Join(errs, err)
+		pending = nil
+	}
+	for _, cmd := range cmds {
+		switch cmd.Action {
+		case "master", "sub":
+			flush()
+			cs, err := m.Master.master(ctx, cmd)
+			cout = append(cout, cs...)
+			errs = errors.Join(errs, err)
+		default:
+			pending = append(pending, cmd)
+		}
+	}
+	flush()
+	return cout, errs
+}
+
+// scale returns the fraction the dim of target is scaled by.
+func (m Master) scale(st *masterState, target string) float64 {
+	f := st.grand / 100
+	for link, v := range st.subs {
+		if targets, _ := m.Linker.Expand(link); slices.Contains(targets, target) {
+			f *= v / 100
+		}
+	}
+	return f
+}
+
+// level returns the level before scaling of the dim a target reports. The
+// level last set is kept while the target still shows it, and forgotten once
+// something else changes the dim. The caller holds the lock.
+func (m Master) level(st *masterState, cmd Cmd) (float64, bool) {
+	actual, err := ParseDim(cmd.Args[0])
+	if err != nil {
+		return 0, false
+	}
+	f := m.scale(st, cmd.Target)
+	if v, ok := m.st.level[cmd.Target]; ok && math.Abs(v*f-actual) <= 1 {
+		return v, true
+	}
+	delete(m.st.level, cmd.Target)
+	if f == 0 {
+		return 0, false
+	}
+	return min(actual/f, 100), true
+}
+
+// Cmd scales dims on the way out, and takes the scale off dim getters on the
+// way back.
+func (m Master) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	cmds = slices.Clone(cmds)
+	m.mu.Lock()
+	for i, cmd := range cmds {
+		if cmd.Action != "dim" || cmd.Target == "" || len(cmd.Args) == 0 {
+			continue
+		}
+		v, err := ParseDim(cmd.Args[0])
+		if err != nil {
+			continue // reported by the backend
+		}
+		if !IsDryRun(ctx) {
+			m.st.level[cmd.Target] = v
+		}
+		f := m.scale(m.st, cmd.Target)
+		cmds[i] = DimCmd(cmd.Target, v*f)
+		cmds[i].Args = append(cmds[i].Args, cmd.Args[1:]...)
+		if f != 1 {
+			trace(ctx, Step{Stage: "master", In: cmd, Out: []Cmd{cmds[i]}, Note: fmt.Sprintf("scaled to %.f%%", f*100)})
+		}
+	}
+	m.mu.Unlock()
+
+	cout, err := m.Cmdr.Cmd(ctx, cmds)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, cmd := range cout {
+		if cmd.Action != "dim" || len(cmd.Args) == 0 {
+			continue
+		}
+		if v, ok := m.level(m.st, cmd); ok {
+			cout[i] = DimCmd(cmd.Target, v)
+		}
+	}
+	return cout, err
+}
+
+// master gets or sets the grand master or a submaster, and sets the dim of
+// the targets it scales again.
+func (m Master) master(ctx context.Context, cmd Cmd) ([]Cmd, error) {
+	var (
+		link = cmd.Target
+		args = cmd.Args
+	)
+	if cmd.Action == "master" {
+		link = ""
+		if cmd.Target != "" {
+			args = append([]string{cmd.Target}, args...)
+		}
+	}
+
+	m.mu.Lock()
+	if len(args) == 0 {
+		defer m.mu.Unlock()
+		if cmd.Action == "master" {
+			return []Cmd{MasterCmd(m.st.grand)}, nil
+		}
+		if link != "" {
+			v, ok := m.st.subs[link]
+			if !ok {
+				v = 100
+			}
+			return []Cmd{SubCmd(link, v)}, nil
+		}
+		var cout []Cmd
+		for _, k := range sortedKeys(m.st.subs) {
+			cout = append(cout, SubCmd(k, m.st.subs[k]))
+		}
+		return cout, nil
+	}
+	m.mu.Unlock()
+
+	if cmd.Action == "sub" && link == "" {
+		return nil, errors.New("sub needs a link")
+	}
+	v, err := ParseDim(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 1 {
+		if _, err := ParseDuration(args); err != nil {
+			return nil, err
+		}
+	}
+
+	// the targets to set again, all of them for the grand master
+	gets := []Cmd{{Action: "dim"}}
+	if link != "" {
+		targets, err := m.Linker.Expand(link)
+		if err != nil {
+			return nil, err
+		}
+		gets = nil
+		for _, t := range targets {
+			gets = append(gets, Cmd{Action: "dim", Target: t})
+		}
+	}
+	cs, gerr := m.Cmdr.Cmd(quiet(ctx), gets)
+
+	m.mu.Lock()
+	old := &masterState{m.st.grand, m.st.subs, m.st.level}
+	st := &masterState{m.st.grand, map[string]float64{}, m.st.level}
+	for k, sv := range m.st.subs {
+		st.subs[k] = sv
+	}
+	if link == "" {
+		st.grand = v
+	} else {
+		st.subs[link] = v
+	}
+	var set []Cmd
+	for _, c := range cs {
+		if c.Action != "dim" || len(c.Args) == 0 {
+			continue
+		}
+		level, ok := m.level(old, c)
+		if !ok {
+			continue
+		}
+		d := DimCmd(c.Target, level*m.scale(st, c.Target))
+		d.Args = append(d.Args, args[1:]...)
+		set = append(set, d)
+		if !IsDryRun(ctx) {
+			m.st.level[c.Target] = level
+		}
+	}
+	if !IsDryRun(ctx) {
+		m.st.grand, m.st.subs = st.grand, st.subs
+	}
+	m.mu.Unlock()
+
+	if len(set) == 0 {
+		return nil, gerr
+	}
+	cout, err := m.Cmdr.Cmd(ctx, set)
+	return cout, errors.Join(gerr, err)
+}
@@ -0,0 +1,141 @@
+package disco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/dedelala/disco/color"
+)
+
+// Parker keeps parked targets where they are, or at the dim and color they are
+// parked at, by dropping the commands that would change them. Unparking sets
+// the last of the dropped state.
+//
+//	park <target> [dim <value>] [color <value>]
+//	unpark <target>
+//
+// The park getter, with no target, lists the parked targets.
+type Parker struct {
+	Cmdr
+
+	mu *sync.Mutex
+	st *parkState
+}
+
+type parkState struct {
+	parked  map[string]Cmd
+	dropped map[[2]string]Cmd
+}
+
+func WithPark(c Cmdr) Parker {
+	return Parker{
+		Cmdr: c,
+		mu:   &sync.Mutex{},
+		st: &parkState{
+			parked:  map[string]Cmd{},
+			dropped: map[[2]string]Cmd{},
+		},
+	}
+}
+
+// parkCmds returns the commands that set the target of a park command to
+// where it is parked. Parking at a dim switches the target on.
+func parkCmds(cmd Cmd) ([]Cmd, error) {
+	var sets []Cmd
+	for args := cmd.Args; len(args) > 0; args = args[2:] {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%s needs a value", args[0])
+		}
+		switch args[0] {
+		case "dim":
+			v, err := ParseDim(args[1])
+			if err != nil {
+				return nil, err
+			}
+			sets = append(sets, SwitchCmd(cmd.Target, true), DimCmd(cmd.Target, v))
+		case "color":
+			c, err := color.Parse(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a color", args[1])
+			}
+			sets = append(sets, ColorCmd(cmd.Target, c))
+		default:
+			return nil, fmt.Errorf("can not park at %s", args[0])
+		}
+	}
+	return sets, nil
+}
+
+func (p Parker) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var (
+		cout []Cmd
+		errs error
+		pass []Cmd
+	)
+	p.mu.Lock()
+	for _, cmd := range cmds {
+		switch cmd.Action {
+		case "park":
+			if cmd.Target == "" {
+				for _, t := range sortedKeys(p.st.parked) {
+					cout = append(cout, p.st.parked[t])
+				}
+				continue
+			}
+			sets, err := parkCmds(cmd)
+			if err != nil {
+				errs = errors.Join(errs, TargetErr(cmd.Target, err))
+				continue
+			}
+			trace(ctx, Step{Stage: "park", In: cmd, Out: sets, Note: "parked"})
+			if !IsDryRun(ctx) {
+				p.st.parked[cmd.Target] = cmd
+			}
+			pass = append(pass, sets...)
+		case "unpark":
+			if cmd.Target == "" {
+				errs = errors.Join(errs, errors.New("unpark needs a target"))
+				continue
+			}
+			var sets []Cmd
+			for _, action := range cached {
+				if c, ok := p.st.dropped[[2]string{action, cmd.Target}]; ok {
+					sets = append(sets, c)
+				}
+			}
+			trace(ctx, Step{Stage: "park", In: cmd, Out: sets, Note: "unparked"})
+			if !IsDryRun(ctx) {
+				delete(p.st.parked, cmd.Target)
+				for _, action := range cached {
+					delete(p.st.dropped, [2]string{action, cmd.Target})
+				}
+			}
+			pass = append(pass, sets...)
+		default:
+			_, parked := p.st.parked[cmd.Target]
+			if !parked || len(cmd.Args) == 0 || !slices.Contains(cached, cmd.Action) {
+				pass = append(pass, cmd)
+				continue
+			}
+			trace(ctx, Step{Stage: "park", In: cmd, Note: "dropped, " + cmd.Target + " is parked"})
+			record(ctx, Result{Cmd: cmd, Status: Skipped, Err: fmt.Errorf("%s is parked", cmd.Target)})
+			set, ok := stateOf(cmd)
+			if cmd.Action == "gradient" {
+				set, ok = cmd, true
+			}
+			if ok && !IsDryRun(ctx) {
+				p.st.dropped[[2]string{set.Action, set.Target}] = set
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	if len(pass) == 0 {
+		return cout, errs
+	}
+	cs, err := p.Cmdr.Cmd(ctx, pass)
+	return append(cout, cs...), errors.Join(errs, err)
+}
@@ -0,0 +1,235 @@
+package disco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dedelala/disco/color"
+)
+
+// Manual is what a Reconciler does when a target is changed by something
+// else, like another app.
+type Manual int
+
+const (
+	// ManualExclude leaves the target alone until it is set again.
+	ManualExclude Manual = iota
+	// ManualAdopt keeps the change as the state to set again.
+	ManualAdopt
+	// ManualRevert sets the target back.
+	ManualRevert
+)
+
+func ParseManual(s string) (Manual, error) {
+	switch s {
+	case "exclude":
+		return ManualExclude, nil
+	case "adopt":
+		return ManualAdopt, nil
+	case "revert":
+		return ManualRevert, nil
+	}
+	return 0, fmt.Errorf("%s is not a manual policy", s)
+}
+
+func (m Manual) String() string {
+	switch m {
+	case ManualExclude:
+		return "exclude"
+	case ManualAdopt:
+		return "adopt"
+	case ManualRevert:
+		return "revert"
+	}
+	return fmt.Sprintf("Manual(%d)", int(m))
+}
+
+// DefaultGrace is how long a Reconciler ignores changes to a target after it
+// is set, on top of any fade.
+const DefaultGrace = 2 * time.Second
+
+// Reconciler remembers the switch, dim and color last set on each target and
+// sets them again when the device comes back after losing power. A device is
+// taken to have come back when it reports "status <target> reachable", or
+// reports switch on while it is meant to be on already.
+//
+// Other changes that differ from the remembered state, once the target has
+// had Grace to settle, are handled according to Manual.
+type Reconciler struct {
+	Cmdr
+	Manual Manual
+	Grace  time.Duration
+
+	mu *sync.Mutex
+	st *reconcileState
+}
+
+type reconcileState struct {
+	want   map[string][]Cmd
+	settle map[string]time.Time
+	manual map[string]bool
+}
+
+func WithReconcile(c Cmdr, manual Manual) Reconciler {
+	return Reconciler{
+		Cmdr:   c,
+		Manual: manual,
+		Grace:  DefaultGrace,
+		mu:     &sync.Mutex{},
+		st: &reconcileState{
+			want:   map[string][]Cmd{},
+			settle: map[string]time.Time{},
+			manual: map[string]bool{},
+		},
+	}
+}
+
+func (r Reconciler) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	cout, err := r.Cmdr.Cmd(ctx, cmds)
+	if IsDryRun(ctx) {
+		return cout, err
+	}
+
+	failed := failedTargets(err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, cmd := range cmds {
+		set, ok := stateOf(cmd)
+		if !ok || failed(cmd.Target) {
+			continue
+		}
+		r.remember(set)
+		delete(r.st.manual, set.Target)
+		r.wait(cmd)
+	}
+	return cout, err
+}
+
+// remember replaces the state of the same action in the target's want.
+func (r Reconciler) remember(set Cmd) {
+	want := slices.DeleteFunc(r.st.want[set.Target], func(c Cmd) bool {
+		return c.Action == set.Action
+	})
+	r.st.want[set.Target] = append(want, set)
+}
+
+// wait ignores changes to the target of cmd until it has faded and settled.
+func (r Reconciler) wait(cmd Cmd) {
+	var d time.Duration
+	if cmd.Action != "switch" || len(cmd.Args) > 1 {
+		d, _ = ParseDuration(cmd.Args)
+	}
+	until := time.Now().Add(d + r.Grace)
+	if until.After(r.st.settle[cmd.Target]) {
+		r.st.settle[cmd.Target] = until
+	}
+}
+
+// Run watches for changes and reconciles them until the watch stream ends.
+func (r Reconciler) Run(ctx context.Context) error {
+	cmds, err := r.Cmdr.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	if cmds == nil {
+		return errors.New("reconcile: nothing to watch")
+	}
+	for cmd := range cmds {
+		if set := r.observe(cmd); len(set) > 0 {
+			slog.Info("reconcile", "target", cmd.Target, "cmds", set)
+			_, err := r.Cmdr.Cmd(ctx, set)
+			if err != nil {
+				slog.Warn("reconcile", "target", cmd.Target, "error", err)
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// observe returns the commands that set the target of cmd back, if any.
+func (r Reconciler) observe(cmd Cmd) []Cmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	want, ok := r.st.want[cmd.Target]
+	if !ok || time.Now().Before(r.st.settle[cmd.Target]) {
+		return nil
+	}
+	if r.st.manual[cmd.Target] {
+		return nil
+	}
+
+	back := cmd.Action == "status" && len(cmd.Args) > 0 && cmd.Args[0] == "reachable"
+	got, ok := stateOf(cmd)
+	if !back && !ok {
+		return nil
+	}
+	i := slices.IndexFunc(want, func(c Cmd) bool { return c.Action == got.Action })
+	switch {
+	case back:
+	case i < 0:
+		return nil
+	case got.Action == "switch" && got.Args[0] == "on" && want[i].Args[0] == "on":
+		back = true
+	case same(want[i], got):
+		return nil
+	}
+
+	if !back {
+		switch r.Manual {
+		case ManualExclude:
+			slog.Info("reconcile excluded", "target", cmd.Target, "cmd", cmd)
+			r.st.manual[cmd.Target] = true
+			return nil
+		case ManualAdopt:
+			r.remember(got)
+			return nil
+		}
+	}
+
+	// switch on first, or off last
+	set := slices.Clone(want)
+	slices.SortStableFunc(set, func(a, b Cmd) int {
+		rank := func(c Cmd) int {
+			switch {
+			case c.Action != "switch":
+				return 0
+			case c.Args[0] == "on":
+				return -1
+			}
+			return 1
+		}
+		return rank(a) - rank(b)
+	})
+	for _, c := range set {
+		r.wait(c)
+	}
+	return set
+}
+
+// same reports whether two states are close enough, allowing for the
+// rounding of the devices.
+func same(a, b Cmd) bool {
+	switch a.Action {
+	case "dim":
+		va, erra := ParseDim(a.Args[0])
+		vb, errb := ParseDim(b.Args[0])
+		return erra == nil && errb == nil && math.Abs(va-vb) <= 1
+	case "color":
+		ca, erra := color.Parse(a.Args[0])
+		cb, errb := color.Parse(b.Args[0])
+		if erra != nil || errb != nil {
+			return false
+		}
+		ra, ga, ba := ca.RGBf()
+		rb, gb, bb := cb.RGBf()
+		return max(math.Abs(ra-rb), math.Abs(ga-gb), math.Abs(ba-bb)) <= 0.1
+	}
+	return slices.Equal(a.Args, b.Args)
+}
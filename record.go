@@ -0,0 +1,27 @@
+package disco
+
+import (
+	"context"
+	"slices"
+)
+
+// Record reads the switch, dim and color of targets through the getters and
+// returns the commands that would set them that way again, compressed with
+// the links of l.
+func Record(ctx context.Context, c Cmdr, l Linker, targets []string) ([]Cmd, error) {
+	var (
+		actions = []string{"switch", "dim", "color"}
+		cmds    []Cmd
+	)
+	for _, action := range actions {
+		for _, target := range targets {
+			cmds = append(cmds, Cmd{Action: action, Target: target})
+		}
+	}
+	cs, err := c.Cmd(ctx, cmds)
+	cs = dedupe(ctx, cs)
+	slices.SortStableFunc(cs, func(a, b Cmd) int {
+		return slices.Index(actions, a.Action) - slices.Index(actions, b.Action)
+	})
+	return l.Compress(cs), err
+}
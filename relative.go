@@ -0,0 +1,217 @@
+package disco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dedelala/disco/color"
+)
+
+// Relative sets the dim and color of targets relative to their current
+// values, which are read through the getters.
+//
+//	dim <target> +n|-n|*n [duration]
+//	color <target> rotate <degrees> [duration]
+//	color <target> saturate|desaturate <percent> [duration]
+//	color <target> shift <color> <percent> [duration]
+type Relative struct {
+	Cmdr
+}
+
+func WithRelative(c Cmdr) Relative {
+	return Relative{c}
+}
+
+// IsRelative reports whether cmd changes its target relative to its current
+// value.
+func IsRelative(cmd Cmd) bool {
+	if len(cmd.Args) == 0 {
+		return false
+	}
+	switch cmd.Action {
+	case "dim":
+		return cmd.Args[0] != "" && strings.ContainsAny(cmd.Args[0][:1], "+-*")
+	case "color":
+		switch cmd.Args[0] {
+		case "rotate", "saturate", "desaturate", "shift":
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRelDim parses a relative dim value into the change it makes.
+func ParseRelDim(s string) (func(float64) float64, error) {
+	if s == "" {
+		return nil, errors.New("no dim value")
+	}
+	v, err := strconv.ParseFloat(s[1:], 64)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("%s is not a relative dim value", s)
+	}
+	clamp := func(v float64) float64 { return max(min(v, 100), 0) }
+	switch s[0] {
+	case '+':
+		return func(d float64) float64 { return clamp(d + v) }, nil
+	case '-':
+		return func(d float64) float64 { return clamp(d - v) }, nil
+	case '*':
+		return func(d float64) float64 { return clamp(d * v) }, nil
+	}
+	return nil, fmt.Errorf("%s is not a relative dim value", s)
+}
+
+// ParseRelColor parses the args of a relative color command into the change
+// it makes and the args that follow.
+func ParseRelColor(args []string) (func(color.Color) color.Color, []string, error) {
+	pct := func(s string) (float64, error) {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 || v > 100 {
+			return 0, fmt.Errorf("%s is not a percentage", s)
+		}
+		return v / 100, nil
+	}
+	need := func(n int) error {
+		if len(args) < n {
+			return fmt.Errorf("%s needs a value", args[0])
+		}
+		return nil
+	}
+	switch args[0] {
+	case "rotate":
+		if err := need(2); err != nil {
+			return nil, nil, err
+		}
+		deg, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s is not a number of degrees", args[1])
+		}
+		return func(c color.Color) color.Color { return c.Rotate(deg / 360) }, args[2:], nil
+	case "saturate", "desaturate":
+		if err := need(2); err != nil {
+			return nil, nil, err
+		}
+		v, err := pct(args[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		if args[0] == "desaturate" {
+			v = -v
+		}
+		return func(c color.Color) color.Color { return c.Saturate(v) }, args[2:], nil
+	case "shift":
+		if err := need(3); err != nil {
+			return nil, nil, err
+		}
+		to, err := color.Parse(args[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s is not a color", args[1])
+		}
+		v, err := pct(args[2])
+		if err != nil {
+			return nil, nil, err
+		}
+		return func(c color.Color) color.Color { return c.Shift(to, v) }, args[3:], nil
+	}
+	return nil, nil, fmt.Errorf("%s is not a relative color", args[0])
+}
+
+func (r Relative) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var gets []Cmd
+	for _, cmd := range cmds {
+		if IsRelative(cmd) && cmd.Target != "" {
+			gets = append(gets, Cmd{Action: cmd.Action, Target: cmd.Target})
+		}
+	}
+	if len(gets) == 0 {
+		return r.Cmdr.Cmd(ctx, cmds)
+	}
+
+	cs, errs := r.Cmdr.Cmd(quiet(ctx), dedupe(context.Background(), gets))
+	state := map[[2]string]Cmd{}
+	for _, cmd := range cs {
+		state[[2]string{cmd.Action, cmd.Target}] = cmd
+	}
+
+	var abs []Cmd
+	for _, cmd := range cmds {
+		if !IsRelative(cmd) {
+			abs = append(abs, cmd)
+			continue
+		}
+		curs := []Cmd{state[[2]string{cmd.Action, cmd.Target}]}
+		if len(curs[0].Args) == 0 && cmd.Action == "color" {
+			// a light with a gradient answers for each of its points
+			curs, _ = r.Cmdr.Cmd(quiet(ctx), []Cmd{{Action: "color", Target: cmd.Target}})
+		}
+		if len(curs) == 0 || len(curs[0].Args) == 0 {
+			es := AsErrors(errs)
+			i := slices.IndexFunc(es, func(e *Error) bool { return e.Target == cmd.Target })
+			if i < 0 {
+				err := TargetErr(cmd.Target, ErrNotFound)
+				errs = errors.Join(errs, err)
+				recordRejected(ctx, cmd, err)
+			} else {
+				recordRejected(ctx, cmd, es[i])
+			}
+			continue
+		}
+		for _, cur := range curs {
+			if len(cur.Args) == 0 {
+				continue
+			}
+			in := cmd
+			in.Target = cur.Target
+			set, err := resolve(in, cur)
+			if err != nil {
+				err = TargetErr(cur.Target, err)
+				errs = errors.Join(errs, err)
+				recordRejected(ctx, in, err)
+				continue
+			}
+			trace(ctx, Step{Stage: "relative", In: cmd, Out: []Cmd{set}, Note: "from " + cur.Args[0]})
+			abs = append(abs, set)
+		}
+	}
+	if len(abs) == 0 {
+		return nil, errs
+	}
+	cout, err := r.Cmdr.Cmd(ctx, abs)
+	return cout, errors.Join(errs, err)
+}
+
+// resolve returns the absolute command for the relative cmd given the
+// current value of its target.
+func resolve(cmd, cur Cmd) (Cmd, error) {
+	switch cmd.Action {
+	case "dim":
+		f, err := ParseRelDim(cmd.Args[0])
+		if err != nil {
+			return Cmd{}, err
+		}
+		v, err := ParseDim(cur.Args[0])
+		if err != nil {
+			return Cmd{}, err
+		}
+		set := DimCmd(cmd.Target, f(v))
+		set.Args = append(set.Args, cmd.Args[1:]...)
+		return set, nil
+	case "color":
+		f, rest, err := ParseRelColor(cmd.Args)
+		if err != nil {
+			return Cmd{}, err
+		}
+		c, err := color.Parse(cur.Args[0])
+		if err != nil {
+			return Cmd{}, err
+		}
+		set := ColorCmd(cmd.Target, f(c))
+		set.Args = append(set.Args, rest...)
+		return set, nil
+	}
+	return Cmd{}, fmt.Errorf("%s is not relative", cmd.Action)
+}
@@ -0,0 +1,119 @@
+package disco
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// replayed is the actions Replay reads the state of. Status tells a light
+// that is off from one that can not be reached.
+var replayed = append(slices.Clone(cached), "status")
+
+// Replay watches c for changes, like Watch, but first emits the state of
+// every target as read through the getters. Changes that happen while the
+// state is read are folded into it, so each target is emitted once with its
+// latest value and there is no gap.
+func Replay(ctx context.Context, c Cmdr) (<-chan Cmd, error) {
+	deltas, err := c.Watch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu     = &sync.Mutex{}
+		queue  []Cmd
+		done   bool
+		notify = make(chan struct{}, 1)
+	)
+	go func() {
+		for cmd := range deltas {
+			mu.Lock()
+			queue = append(queue, cmd)
+			mu.Unlock()
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}
+		mu.Lock()
+		done = true
+		mu.Unlock()
+		close(notify)
+	}()
+
+	gets := make([]Cmd, len(replayed))
+	for i, action := range replayed {
+		gets[i] = Cmd{Action: action}
+	}
+	state, err := c.Cmd(ctx, gets)
+	if len(state) == 0 && err != nil {
+		return nil, err
+	}
+	if err != nil {
+		slog.Warn("replay", "error", err)
+	}
+
+	// the changes held back while the state was read are newer than it, or
+	// the same as it
+	mu.Lock()
+	held := queue
+	queue = nil
+	mu.Unlock()
+	var (
+		model = map[[2]string]int{}
+		first []Cmd
+	)
+	for _, cmd := range slices.Concat(state, held) {
+		if !slices.Contains(replayed, cmd.Action) || len(cmd.Args) == 0 {
+			first = append(first, cmd)
+			continue
+		}
+		k := [2]string{cmd.Action, cmd.Target}
+		if i, ok := model[k]; ok {
+			first[i] = cmd
+			continue
+		}
+		model[k] = len(first)
+		first = append(first, cmd)
+	}
+
+	cout := make(chan Cmd)
+	send := func(cmd Cmd) bool {
+		select {
+		case cout <- cmd:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	go func() {
+		defer close(cout)
+		for _, cmd := range first {
+			if !send(cmd) {
+				return
+			}
+		}
+		for {
+			mu.Lock()
+			cmds, fin := queue, done
+			queue = nil
+			mu.Unlock()
+			for _, cmd := range cmds {
+				if !send(cmd) {
+					return
+				}
+			}
+			if fin {
+				return
+			}
+			select {
+			case <-notify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return cout, nil
+}
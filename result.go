@@ -0,0 +1,198 @@
+package disco
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrUnsupported is returned by backends for a command the device is not
+	// capable of.
+	ErrUnsupported = errors.New("unsupported")
+	// ErrUnreachable is returned by backends for a device that did not
+	// respond.
+	ErrUnreachable = errors.New("unreachable")
+)
+
+// Status is the outcome of a command on a target.
+type Status int
+
+const (
+	Applied Status = iota
+	Invalid
+	Unsupported
+	Unreachable
+	TimedOut
+	// Held is a command kept to apply later, such as during a blackout.
+	Held
+	// Skipped is a command deliberately not sent to a backend.
+	Skipped
+)
+
+func (s Status) String() string {
+	switch s {
+	case Applied:
+		return "applied"
+	case Invalid:
+		return "invalid"
+	case Unsupported:
+		return "unsupported"
+	case Unreachable:
+		return "unreachable"
+	case TimedOut:
+		return "timeout"
+	case Held:
+		return "held"
+	case Skipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// Status classifies the error. Errors not attributed to a target are taken
+// to mean the backend could not be reached.
+func (e *Error) Status() Status {
+	switch {
+	case errors.Is(e.Err, context.DeadlineExceeded), errors.Is(e.Err, context.Canceled):
+		return TimedOut
+	case errors.Is(e.Err, ErrUnsupported):
+		return Unsupported
+	case errors.Is(e.Err, ErrNotFound), errors.Is(e.Err, ErrUnreachable):
+		return Unreachable
+	case e.Target == "":
+		return Unreachable
+	}
+	return Invalid
+}
+
+// Result is the outcome of one command after expansion. Cmd is the command as
+// the caller would address it and Device is the prefixed device ID it was
+// resolved to.
+type Result struct {
+	Cmd    Cmd
+	Device string
+	Status Status
+	Err    error
+}
+
+// Results collects the Result of every command sent to a backend.
+type Results struct {
+	mu *sync.Mutex
+	rs []Result
+}
+
+type resultsKey struct{}
+
+type recorder func(Result)
+
+// WithResults returns a context that collects results into the returned
+// Results.
+func WithResults(ctx context.Context) (context.Context, *Results) {
+	rs := &Results{mu: &sync.Mutex{}}
+	return context.WithValue(ctx, resultsKey{}, recorder(rs.add)), rs
+}
+
+// collect returns a context that collects results into the returned Results
+// as well as wherever ctx collects them.
+func collect(ctx context.Context) (context.Context, *Results) {
+	rs := &Results{mu: &sync.Mutex{}}
+	parent, _ := ctx.Value(resultsKey{}).(recorder)
+	return context.WithValue(ctx, resultsKey{}, recorder(func(r Result) {
+		rs.add(r)
+		if parent != nil {
+			parent(r)
+		}
+	})), rs
+}
+
+func (rs *Results) add(r Result) {
+	rs.mu.Lock()
+	rs.rs = append(rs.rs, r)
+	rs.mu.Unlock()
+}
+
+// List returns the results collected so far.
+func (rs *Results) List() []Result {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return append([]Result(nil), rs.rs...)
+}
+
+func recording(ctx context.Context) bool {
+	_, ok := ctx.Value(resultsKey{}).(recorder)
+	return ok
+}
+
+func record(ctx context.Context, r Result) {
+	if f, ok := ctx.Value(resultsKey{}).(recorder); ok {
+		f(r)
+	}
+}
+
+// withRecorder rewrites results recorded through the returned context before
+// they are collected.
+func withRecorder(ctx context.Context, f func(Result) Result) context.Context {
+	parent, ok := ctx.Value(resultsKey{}).(recorder)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, resultsKey{}, recorder(func(r Result) {
+		parent(f(r))
+	}))
+}
+
+// recordRejected records a result for cmd, which err kept from reaching a
+// backend.
+func recordRejected(ctx context.Context, cmd Cmd, err error) {
+	r := Result{Cmd: cmd, Status: Invalid, Err: err}
+	if es := AsErrors(err); len(es) > 0 {
+		r.Status, r.Err = es[0].Status(), es[0].Err
+		if es[0].Target == "" && es[0].Backend == "" {
+			// not from a backend, so the command itself is wrong
+			r.Status = Invalid
+		}
+	}
+	record(ctx, r)
+}
+
+// recordResults records a result for each of cmds addressed to a target
+// according to the errors that targets returned.
+func recordResults(ctx context.Context, cmds []Cmd, es Errors) {
+	if !recording(ctx) {
+		return
+	}
+	var (
+		byTarget = map[string]*Error{}
+		backend  *Error
+	)
+	for _, e := range es {
+		if e.Target == "" {
+			backend = e
+			continue
+		}
+		byTarget[e.Target] = e
+	}
+	for _, cmd := range cmds {
+		if cmd.Target == "" {
+			continue
+		}
+		r := Result{Cmd: cmd, Device: cmd.Target}
+		e, ok := byTarget[cmd.Target]
+		if !ok {
+			// sub targets such as gradient points fail with their device
+			if i := strings.LastIndex(cmd.Target, "/"); i > 0 {
+				e, ok = byTarget[cmd.Target[:i]]
+			}
+		}
+		if !ok {
+			e = backend
+		}
+		if e != nil {
+			r.Status = e.Status()
+			r.Err = e.Err
+		}
+		record(ctx, r)
+	}
+}
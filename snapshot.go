@@ -0,0 +1,155 @@
+package disco
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// Snapshotter handles the snapshot and restore actions. A snapshot captures
+// the switch, dim and color of every target, or of the targets of a link,
+// through the getters. Restoring a snapshot fades back to it. Snapshots are
+// saved to File if it is set.
+type Snapshotter struct {
+	Cmdr
+	File string
+
+	mu    *sync.Mutex
+	snaps map[string][]string
+}
+
+func WithSnapshot(c Cmdr, file string) Snapshotter {
+	return Snapshotter{
+		Cmdr:  c,
+		File:  file,
+		mu:    &sync.Mutex{},
+		snaps: map[string][]string{},
+	}
+}
+
+// Cmd runs commands in order, so a snapshot in a cue sees the state left by
+// the commands before it.
+func (s Snapshotter) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var (
+		cout    []Cmd
+		errs    error
+		pending []Cmd
+	)
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		cs, err := s.Cmdr.Cmd(ctx, pending)
+		cout = append(cout, cs...)
+		errs = errors.Join(errs, err)
+		pending = nil
+	}
+	for _, cmd := range cmds {
+		switch cmd.Action {
+		case "snapshot":
+			flush()
+			errs = errors.Join(errs, s.snapshot(ctx, cmd))
+		case "restore":
+			flush()
+			cs, err := s.restore(ctx, cmd)
+			cout = append(cout, cs...)
+			errs = errors.Join(errs, err)
+		default:
+			pending = append(pending, cmd)
+		}
+	}
+	flush()
+	return cout, errs
+}
+
+func (s Snapshotter) snapshot(ctx context.Context, cmd Cmd) error {
+	if cmd.Target == "" {
+		return errors.New("snapshot needs a name")
+	}
+	var target string
+	if len(cmd.Args) > 0 {
+		target = cmd.Args[0]
+	}
+	cs, err := s.Cmdr.Cmd(ctx, []Cmd{
+		{Action: "switch", Target: target},
+		{Action: "dim", Target: target},
+		{Action: "color", Target: target},
+	})
+	if len(cs) == 0 {
+		return err
+	}
+	snap := make([]string, len(cs))
+	for i := range cs {
+		snap[i] = cs[i].String()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	if IsDryRun(ctx) {
+		return err
+	}
+	s.snaps[cmd.Target] = snap
+	return errors.Join(err, s.save())
+}
+
+func (s Snapshotter) restore(ctx context.Context, cmd Cmd) ([]Cmd, error) {
+	s.mu.Lock()
+	err := s.load()
+	snap, ok := s.snaps[cmd.Target]
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("snapshot not found: %q", cmd.Target)
+	}
+
+	var cmds []Cmd
+	for _, line := range snap {
+		c := ParseCmdString(line)
+		if c.Action != "switch" && len(cmd.Args) > 0 {
+			c.Args = append(c.Args, cmd.Args[0])
+		}
+		cmds = append(cmds, c)
+	}
+	return s.Cmdr.Cmd(ctx, cmds)
+}
+
+func (s Snapshotter) load() error {
+	if s.File == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.File)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("snapshot load: %w", err)
+	}
+	clear(s.snaps)
+	if err := json.Unmarshal(b, &s.snaps); err != nil {
+		return fmt.Errorf("snapshot load: %w", err)
+	}
+	return nil
+}
+
+func (s Snapshotter) save() error {
+	if s.File == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.snaps, "", "  ")
+	if err != nil {
+		return fmt.Errorf("snapshot save: %w", err)
+	}
+	if err := os.WriteFile(s.File, b, 0644); err != nil {
+		return fmt.Errorf("snapshot save: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package disco
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// A SwitchFader is a Cmdr that fades switches over a duration itself.
+type SwitchFader interface {
+	FadesSwitch() bool
+}
+
+// SwitchFade fades switches over a duration with the dimmer, for backends
+// that can not do it themselves. Switching off fades to black, switches off,
+// then sets the dimmer back so the next switch on returns to the same level.
+// Switching on switches on at zero and fades up.
+//
+//	switch <target> on|off [duration]
+//
+// The switch off happens after the call returns, unless the target is set
+// again first.
+type SwitchFade struct {
+	Cmdr
+
+	mu      *sync.Mutex
+	pending map[string]*fadeOff
+	wg      *sync.WaitGroup
+}
+
+// fadeOff is a switch off waiting for the fade to black.
+type fadeOff struct {
+	level  Cmd
+	cancel func()
+}
+
+func WithSwitchFade(c Cmdr) SwitchFade {
+	return SwitchFade{
+		Cmdr:    c,
+		mu:      &sync.Mutex{},
+		pending: map[string]*fadeOff{},
+		wg:      &sync.WaitGroup{},
+	}
+}
+
+// Wait waits for the switches still to go off.
+func (f SwitchFade) Wait() {
+	f.wg.Wait()
+}
+
+func (f SwitchFade) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var (
+		cout []Cmd
+		errs error
+		call = func(cmds []Cmd) {
+			if len(cmds) == 0 {
+				return
+			}
+			cs, err := f.Cmdr.Cmd(ctx, cmds)
+			cout = append(cout, cs...)
+			errs = errors.Join(errs, err)
+		}
+	)
+
+	// a switch off still to come is called off by anything new, and the
+	// level is set back unless it is being set anyway
+	var restore []Cmd
+	f.mu.Lock()
+	for _, cmd := range cmds {
+		p, ok := f.pending[cmd.Target]
+		if !ok || len(cmd.Args) == 0 {
+			continue
+		}
+		p.cancel()
+		delete(f.pending, cmd.Target)
+		if !slices.ContainsFunc(cmds, func(c Cmd) bool {
+			return c.Action == "dim" && c.Target == cmd.Target && len(c.Args) > 0
+		}) {
+			restore = append(restore, p.level)
+		}
+	}
+	f.mu.Unlock()
+	call(restore)
+
+	var (
+		fades []Cmd
+		now   []Cmd
+		gets  []Cmd
+	)
+	for _, cmd := range cmds {
+		if cmd.Action == "switch" && cmd.Target != "" && len(cmd.Args) > 1 {
+			fades = append(fades, cmd)
+			gets = append(gets,
+				Cmd{Action: "switch", Target: cmd.Target},
+				Cmd{Action: "dim", Target: cmd.Target},
+			)
+			continue
+		}
+		now = append(now, cmd)
+	}
+	if len(fades) == 0 {
+		return f.Cmdr.Cmd(ctx, cmds)
+	}
+
+	cs, _ := f.Cmdr.Cmd(quiet(ctx), gets)
+	state := map[[2]string]string{}
+	for _, c := range cs {
+		if len(c.Args) > 0 {
+			state[[2]string{c.Action, c.Target}] = c.Args[0]
+		}
+	}
+
+	var (
+		ups  []Cmd
+		offs = map[string]time.Duration{}
+	)
+	for _, cmd := range fades {
+		d, err := ParseDuration(cmd.Args)
+		if err != nil {
+			errs = errors.Join(errs, TargetErr(cmd.Target, err))
+			continue
+		}
+		on, err := ParseSwitch(cmd.Args[0])
+		if err != nil {
+			errs = errors.Join(errs, TargetErr(cmd.Target, err))
+			continue
+		}
+		sw, level := state[[2]string{"switch", cmd.Target}], state[[2]string{"dim", cmd.Target}]
+		if level == "" || sw == cmd.Args[0] {
+			// nothing to fade
+			now = append(now, SwitchCmd(cmd.Target, on))
+			continue
+		}
+		dur := d.String()
+		if on {
+			now = append(now, Cmd{Action: "dim", Target: cmd.Target, Args: []string{"0", "0s"}})
+			ups = append(ups,
+				SwitchCmd(cmd.Target, true),
+				Cmd{Action: "dim", Target: cmd.Target, Args: []string{level, dur}},
+			)
+			trace(ctx, Step{Stage: "fade", In: cmd, Out: ups[len(ups)-2:], Note: "fade up from 0"})
+			continue
+		}
+		now = append(now, Cmd{Action: "dim", Target: cmd.Target, Args: []string{"0", dur}})
+		offs[cmd.Target] = d
+		trace(ctx, Step{Stage: "fade", In: cmd, Out: []Cmd{SwitchCmd(cmd.Target, false)}, Note: "fade to black, then back to " + level})
+	}
+	call(now)
+	call(ups)
+
+	for target, d := range offs {
+		level := Cmd{Action: "dim", Target: target, Args: []string{state[[2]string{"dim", target}], "0s"}}
+		off := []Cmd{SwitchCmd(target, false), level}
+		if IsDryRun(ctx) {
+			call(off)
+			continue
+		}
+		fctx, cancel := context.WithCancel(quiet(context.WithoutCancel(ctx)))
+		p := &fadeOff{level, cancel}
+		f.mu.Lock()
+		f.pending[target] = p
+		f.mu.Unlock()
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			defer cancel()
+			select {
+			case <-time.After(d):
+			case <-fctx.Done():
+				return
+			}
+			f.mu.Lock()
+			if f.pending[target] != p {
+				f.mu.Unlock()
+				return
+			}
+			delete(f.pending, target)
+			f.mu.Unlock()
+			if _, err := f.Cmdr.Cmd(fctx, off); err != nil {
+				slog.Warn("switch fade", "target", target, "error", err)
+			}
+		}()
+	}
+	return cout, errs
+}
@@ -0,0 +1,102 @@
+package disco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Rules for toggling a link.
+const (
+	// ToggleAny switches everything off if any of it is on.
+	ToggleAny = "any"
+	// ToggleMajority switches everything off if most of it is on.
+	ToggleMajority = "majority"
+)
+
+// Toggler switches targets on if they are off, or off if they are on. The
+// switches of a link are counted according to Rule, ToggleAny if empty, which
+// the command can override.
+//
+//	toggle <target> [any|majority]
+type Toggler struct {
+	Cmdr
+	Rule string
+}
+
+func WithToggle(c Cmdr, rule string) Toggler {
+	return Toggler{c, rule}
+}
+
+// CheckToggleRule validates a toggle rule.
+func CheckToggleRule(rule string) error {
+	switch rule {
+	case "", ToggleAny, ToggleMajority:
+		return nil
+	}
+	return fmt.Errorf("%s is not a toggle rule", rule)
+}
+
+func (t Toggler) Cmd(ctx context.Context, cmds []Cmd) ([]Cmd, error) {
+	var (
+		set  []Cmd
+		errs error
+	)
+	for _, cmd := range cmds {
+		if cmd.Action != "toggle" {
+			set = append(set, cmd)
+			continue
+		}
+		c, err := t.toggle(ctx, cmd)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			recordRejected(ctx, cmd, err)
+			continue
+		}
+		set = append(set, c)
+	}
+	if len(set) == 0 {
+		return nil, errs
+	}
+	cout, err := t.Cmdr.Cmd(ctx, set)
+	return cout, errors.Join(errs, err)
+}
+
+func (t Toggler) toggle(ctx context.Context, cmd Cmd) (Cmd, error) {
+	if cmd.Target == "" {
+		return Cmd{}, errors.New("toggle needs a target")
+	}
+	rule := t.Rule
+	if len(cmd.Args) > 0 {
+		rule = cmd.Args[0]
+	}
+	if err := CheckToggleRule(rule); err != nil {
+		return Cmd{}, TargetErr(cmd.Target, err)
+	}
+
+	cs, err := t.Cmdr.Cmd(quiet(ctx), []Cmd{{Action: "switch", Target: cmd.Target}})
+	var on, n int
+	for _, c := range cs {
+		if c.Action != "switch" || len(c.Args) == 0 {
+			continue
+		}
+		n++
+		if c.Args[0] == "on" {
+			on++
+		}
+	}
+	if n == 0 {
+		if err != nil {
+			return Cmd{}, err
+		}
+		return Cmd{}, TargetErr(cmd.Target, ErrNotFound)
+	}
+
+	off := on > 0
+	if rule == ToggleMajority {
+		off = 2*on > n
+	}
+	set := SwitchCmd(cmd.Target, !off)
+	trace(ctx, Step{Stage: "toggle", In: cmd, Out: []Cmd{set}, Note: fmt.Sprintf("%d of %d on", on, n)})
+	return set, nil
+}
@@ -0,0 +1,52 @@
+package disco
+
+import (
+	"context"
+	"sync"
+)
+
+// Step is one command passing through one stage of the pipeline. Out is what
+// the stage made of it, empty if the command was dropped. Note says why,
+// naming the cue, link, map entry or backend involved.
+type Step struct {
+	Stage string
+	In    Cmd
+	Out   []Cmd
+	Note  string
+}
+
+// Trace collects the Step of every stage a command passes through.
+type Trace struct {
+	mu *sync.Mutex
+	ss []Step
+}
+
+type traceKey struct{}
+
+// WithTrace returns a context that collects steps into the returned Trace.
+func WithTrace(ctx context.Context) (context.Context, *Trace) {
+	t := &Trace{mu: &sync.Mutex{}}
+	return context.WithValue(ctx, traceKey{}, t), t
+}
+
+// List returns the steps collected so far in the order they were taken.
+func (t *Trace) List() []Step {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Step(nil), t.ss...)
+}
+
+func tracing(ctx context.Context) bool {
+	_, ok := ctx.Value(traceKey{}).(*Trace)
+	return ok
+}
+
+func trace(ctx context.Context, s Step) {
+	t, ok := ctx.Value(traceKey{}).(*Trace)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	t.ss = append(t.ss, s)
+	t.mu.Unlock()
+}